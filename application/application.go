@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/urfave/cli"
+
+	"github.com/EarvinKayonga/rider/storage"
 )
 
 // RunBike is a wrapper in order to keep the the main function tidy.
@@ -29,6 +31,12 @@ func RunBike(args []string, m Metadata) error {
 				configurationFlag(),
 				databaseFlag(),
 				nsqLookUpFlag(),
+				nsqFlag(),
+			},
+
+			Commands: []cli.Command{
+				migrateCommand(bikeDatabase, storage.BikeMigrations),
+				dlqCommand(bikeConsumption),
 			},
 
 			Action: func(c *cli.Context) error {
@@ -59,7 +67,7 @@ func RunGateway(args []string, m Metadata) error {
 
 			Metadata: m.ToMap(),
 
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				configurationFlag(),
 
 				cli.StringFlag{
@@ -82,7 +90,7 @@ func RunGateway(args []string, m Metadata) error {
 					EnvVar: "NSQ_SOCKET",
 					Value:  "0.0.0.0:4150",
 				},
-			},
+			}, authFlags()...),
 
 			Action: func(c *cli.Context) error {
 				return gateway(c, m)
@@ -116,6 +124,12 @@ func RunTrip(args []string, m Metadata) error {
 				configurationFlag(),
 				databaseFlag(),
 				nsqLookUpFlag(),
+				nsqFlag(),
+			},
+
+			Commands: []cli.Command{
+				migrateCommand(tripDatabase, storage.TripMigrations),
+				dlqCommand(tripConsumption),
 			},
 
 			Action: func(c *cli.Context) error {
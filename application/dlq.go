@@ -0,0 +1,142 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/messaging"
+)
+
+// consumptionLoader reads the messaging configuration of a service.
+type consumptionLoader func(c *cli.Context) (configuration.Consumption, error)
+
+// bikeConsumption loads the messaging configuration of the bike service.
+func bikeConsumption(c *cli.Context) (configuration.Consumption, error) {
+	config, err := configuration.GetBikeConfiguration(configFromContext(c),
+		databaseFromContext(c),
+		nsqLookupFromContext(c),
+		nsqFromContext(c))
+	if err != nil {
+		return configuration.Consumption{}, errors.Wrap(err,
+			"an error occured while reading bike configuration")
+	}
+
+	return config.Messaging.Consumption, nil
+}
+
+// tripConsumption loads the messaging configuration of the trip service.
+func tripConsumption(c *cli.Context) (configuration.Consumption, error) {
+	config, err := configuration.GetTripConfiguration(configFromContext(c),
+		databaseFromContext(c),
+		nsqLookupFromContext(c),
+		nsqFromContext(c))
+	if err != nil {
+		return configuration.Consumption{}, errors.Wrap(err,
+			"an error occured while reading trip configuration")
+	}
+
+	return config.Messaging.Consumption, nil
+}
+
+// dlqFlags creates the Flags of the dlq commands.
+func dlqFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:  "limit",
+			Usage: "maximum number of dead letters",
+			Value: 100,
+		},
+		cli.DurationFlag{
+			Name:  "wait",
+			Usage: "stops once no dead letter arrived for this long",
+			Value: 2 * time.Second,
+		},
+	}
+}
+
+// dlqCommand creates the dlq command of a service
+// with its list and replay subcommands.
+func dlqCommand(load consumptionLoader) cli.Command {
+	return cli.Command{
+		Name:  "dlq",
+		Usage: "inspects and replays the messages given up on",
+
+		Subcommands: []cli.Command{
+			{
+				Name:  "list",
+				Usage: "prints dead letters as json lines, leaving them in the queue",
+				Flags: dlqFlags(),
+				Action: func(c *cli.Context) error {
+					return withDeadLetterQueue(c, load, func(ctx context.Context, queue *messaging.DeadLetterQueue) error {
+						letters, err := queue.Inspect(ctx, c.Int("limit"), c.Duration("wait"))
+						thr := printDeadLetters(letters)
+						if err != nil {
+							return errors.Wrap(err, "an error occured while reading dead letters")
+						}
+
+						return thr
+					})
+				},
+			},
+
+			{
+				Name:  "replay",
+				Usage: "publishes dead letters back to their topic, removing them from the queue",
+				Flags: dlqFlags(),
+				Action: func(c *cli.Context) error {
+					return withDeadLetterQueue(c, load, func(ctx context.Context, queue *messaging.DeadLetterQueue) error {
+						letters, err := queue.Replay(ctx, c.Int("limit"), c.Duration("wait"))
+						for _, letter := range letters {
+							fmt.Printf("replayed %s to %s\n", letter.ID, letter.Topic)
+						}
+
+						if err != nil {
+							return errors.Wrap(err, "an error occured while replaying dead letters")
+						}
+
+						return nil
+					})
+				},
+			},
+		},
+	}
+}
+
+// withDeadLetterQueue opens the dead letter queue of a service for the duration of callback.
+func withDeadLetterQueue(c *cli.Context, load consumptionLoader,
+	callback func(context.Context, *messaging.DeadLetterQueue) error) error {
+
+	return makeCancellable(func(ctx context.Context) error {
+		consumption, err := load(c)
+		if err != nil {
+			return err
+		}
+
+		queue, err := messaging.NewDeadLetterQueue(consumption)
+		if err != nil {
+			return errors.Wrap(err,
+				"an error occured while opening dead letter queue")
+		}
+
+		return callback(ctx, queue)
+	})
+}
+
+func printDeadLetters(letters []messaging.DeadLetter) error {
+	encoder := json.NewEncoder(os.Stdout)
+	for _, letter := range letters {
+		err := encoder.Encode(letter)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
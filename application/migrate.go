@@ -0,0 +1,173 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/storage"
+)
+
+// databaseLoader reads the database and logging configuration of a service.
+type databaseLoader func(c *cli.Context) (configuration.Database, configuration.Logging, error)
+
+// bikeDatabase loads the database configuration of the bike service.
+func bikeDatabase(c *cli.Context) (configuration.Database, configuration.Logging, error) {
+	config, err := configuration.GetBikeConfiguration(configFromContext(c),
+		databaseFromContext(c),
+		nsqLookupFromContext(c),
+		nsqFromContext(c))
+	if err != nil {
+		return configuration.Database{}, configuration.Logging{}, errors.Wrap(err,
+			"an error occured while reading bike configuration")
+	}
+
+	return config.Database, config.Logging, nil
+}
+
+// tripDatabase loads the database configuration of the trip service.
+func tripDatabase(c *cli.Context) (configuration.Database, configuration.Logging, error) {
+	config, err := configuration.GetTripConfiguration(configFromContext(c),
+		databaseFromContext(c),
+		nsqLookupFromContext(c),
+		nsqFromContext(c))
+	if err != nil {
+		return configuration.Database{}, configuration.Logging{}, errors.Wrap(err,
+			"an error occured while reading trip configuration")
+	}
+
+	return config.Database, config.Logging, nil
+}
+
+// stepsFlag  creates a Flag for the migrate commands.
+func stepsFlag(usage string) cli.IntFlag {
+	return cli.IntFlag{
+		Name:  "steps",
+		Usage: usage,
+	}
+}
+
+// migrateCommand creates the migrate command of a service
+// with its up, down and status subcommands.
+func migrateCommand(load databaseLoader, migrations []storage.Migration) cli.Command {
+	return cli.Command{
+		Name:  "migrate",
+		Usage: "manages the database schema",
+
+		Subcommands: []cli.Command{
+			{
+				Name:  "up",
+				Usage: "applies pending migrations",
+				Flags: []cli.Flag{
+					stepsFlag("number of migrations to apply, all when omitted"),
+				},
+				Action: func(c *cli.Context) error {
+					return withMigrator(c, load, func(ctx context.Context, migrator storage.Migrator) error {
+						applied, err := migrator.MigrateUp(ctx, migrations, c.Int("steps"))
+						if err != nil {
+							return errors.Wrap(err, "an error occured while applying migrations")
+						}
+
+						for _, migration := range applied {
+							fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+						}
+
+						return nil
+					})
+				},
+			},
+
+			{
+				Name:  "down",
+				Usage: "reverts applied migrations",
+				Flags: []cli.Flag{
+					stepsFlag("number of migrations to revert, one when omitted"),
+				},
+				Action: func(c *cli.Context) error {
+					return withMigrator(c, load, func(ctx context.Context, migrator storage.Migrator) error {
+						reverted, err := migrator.MigrateDown(ctx, migrations, c.Int("steps"))
+						if err != nil {
+							return errors.Wrap(err, "an error occured while reverting migrations")
+						}
+
+						for _, migration := range reverted {
+							fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+						}
+
+						return nil
+					})
+				},
+			},
+
+			{
+				Name:  "status",
+				Usage: "lists migrations and whether they are applied",
+				Action: func(c *cli.Context) error {
+					return withMigrator(c, load, func(ctx context.Context, migrator storage.Migrator) error {
+						statuses, err := migrator.MigrationStatus(ctx, migrations)
+						if err != nil {
+							return errors.Wrap(err, "an error occured while reading migrations status")
+						}
+
+						return printMigrationStatus(statuses)
+					})
+				},
+			},
+		},
+	}
+}
+
+// withMigrator opens the database of a service for the duration of callback.
+func withMigrator(c *cli.Context, load databaseLoader,
+	callback func(context.Context, storage.Migrator) error) error {
+
+	return makeCancellable(func(ctx context.Context) error {
+		database, logInfo, err := load(c)
+		if err != nil {
+			return err
+		}
+
+		logger := logging.NewLogger(logInfo)
+		store, err := storage.NewDatabase(ctx, database, *logger)
+		if err != nil {
+			return errors.Wrap(err,
+				"an error occured while contacting database")
+		}
+
+		defer func() {
+			thr := store.Close(ctx)
+			if thr != nil {
+				logger.WithError(thr).Warn("error while closing database")
+			}
+		}()
+
+		return callback(ctx, store)
+	})
+}
+
+func printMigrationStatus(statuses []storage.MigrationStatus) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state = "applied"
+		}
+
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+
+	return w.Flush()
+}
@@ -10,8 +10,10 @@ import (
 
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/entropy"
+	"github.com/EarvinKayonga/rider/httpx"
 	"github.com/EarvinKayonga/rider/messaging"
 	"github.com/EarvinKayonga/rider/storage"
+	"github.com/EarvinKayonga/rider/tracing"
 	"github.com/EarvinKayonga/rider/transport"
 )
 
@@ -19,90 +21,152 @@ func trip(c *cli.Context, m Metadata) error {
 	return makeCancellable(func(ctx context.Context) error {
 		config, err := configuration.GetTripConfiguration(configFromContext(c),
 			databaseFromContext(c),
-			nsqLookupFromContext(c))
+			nsqLookupFromContext(c),
+			nsqFromContext(c))
 		if err != nil {
 			return errors.Wrap(err,
 				"an error occured while reading trip configuration")
 		}
 
-		logger, statsd, err := createInfraTools(ctx, config.Logging, config.Monitoring)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while creating tools for infra")
-		}
-
-		database, err := storage.NewPostgresDatabase(ctx, config.Database, *logger)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while contacting database")
-		}
-
-		ctx = storage.NewContext(ctx, database)
-		service, err := transport.NewTripService(ctx, m.ToMap(), *config, *logger, statsd)
-		if err != nil {
-			return errors.Wrap(
-				err, "an error occured while initialising trip service")
-		}
-
-		listener, err := domain.ListenerToTripEvent(ctx, *config, *logger, database)
-		if err != nil {
-			return errors.Wrap(
-				err, "an error occured while initialising background listener service")
-		}
+		return runTrip(ctx, *config, m)
+	})
+}
 
-		ctx = entropy.NewContext(ctx, entropy.NewIDGenerator())
-		return runServiceWithListener(ctx, config.Server, service, *logger, listener, func(ctx context.Context) {
+// runTrip runs the trip service until ctx is done.
+func runTrip(ctx context.Context, config configuration.TripConfiguration, m Metadata) error {
+	logger, statsd, err := createInfraTools(ctx, config.Logging, config.Monitoring)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating tools for infra")
+	}
+
+	tracer, err := tracing.NewTracer("trip", config.Tracing, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating tracer")
+	}
+
+	ctx = tracing.NewContext(ctx, tracer)
+
+	database, err := storage.NewDatabase(ctx, config.Database, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while contacting database")
+	}
+
+	err = storage.EnsureSchema(ctx, database, storage.TripMigrations, config.Database.AutoMigrate, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while checking database schema")
+	}
+
+	ctx = storage.NewContext(ctx, database)
+	ctx = entropy.NewContext(ctx, entropy.NewIDGenerator())
+	service, err := transport.NewTripService(ctx, m.ToMap(), config, *logger, statsd)
+	if err != nil {
+		return errors.Wrap(
+			err, "an error occured while initialising trip service")
+	}
+
+	listener, err := domain.ListenerToTripEvent(ctx, config, *logger, database)
+	if err != nil {
+		return errors.Wrap(
+			err, "an error occured while initialising background listener service")
+	}
+
+	messenger, err := messaging.NewEmitter(ctx, Trip, config.Messaging.Emission, *logger, statsd)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating messenger")
+	}
+
+	relay := domain.NewOutboxRelay(config.Outbox, database, messenger, *logger)
+
+	return runServiceWithListener(ctx, config.Server, service, *logger,
+		[]messaging.Consumer{listener, relay},
+		func(ctx context.Context) {
 			database.Close(ctx)
+			closeTracer(tracer, *logger)
 		})
-	})
 }
 
 func bike(c *cli.Context, m Metadata) error {
 	return makeCancellable(func(ctx context.Context) error {
 		config, err := configuration.GetBikeConfiguration(configFromContext(c),
 			databaseFromContext(c),
-			nsqLookupFromContext(c))
+			nsqLookupFromContext(c),
+			nsqFromContext(c))
 		if err != nil {
 			return errors.Wrap(err,
 				"an error occured while reading bike configuration")
 		}
 
-		logger, statsd, err := createInfraTools(ctx, config.Logging, config.Monitoring)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while creating tools for infra")
-		}
-
-		database, err := storage.NewPostgresDatabase(ctx, config.Database, *logger)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while contacting database")
-		}
-
-		err = domain.PopulateDatabase(ctx, database)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while populate database")
-		}
-
-		ctx = storage.NewContext(ctx, database)
-		service, err := transport.NewBikeService(ctx, m.ToMap(), *config, *logger, statsd)
-		if err != nil {
-			return errors.Wrap(
-				err, "an error occured while initialising bike service")
-		}
-
-		listener, err := domain.ListenerToBikeEvent(ctx, *config, *logger, database)
-		if err != nil {
-			return errors.Wrap(
-				err, "an error occured while initialising background listener service")
-		}
+		return runBike(ctx, *config, m)
+	})
+}
 
-		ctx = entropy.NewContext(ctx, entropy.NewIDGenerator())
-		return runServiceWithListener(ctx, config.Server, service, *logger, listener, func(ctx context.Context) {
+// runBike runs the bike service until ctx is done.
+func runBike(ctx context.Context, config configuration.BikeConfiguration, m Metadata) error {
+	logger, statsd, err := createInfraTools(ctx, config.Logging, config.Monitoring)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating tools for infra")
+	}
+
+	tracer, err := tracing.NewTracer("bike", config.Tracing, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating tracer")
+	}
+
+	ctx = tracing.NewContext(ctx, tracer)
+
+	database, err := storage.NewDatabase(ctx, config.Database, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while contacting database")
+	}
+
+	err = storage.EnsureSchema(ctx, database, storage.BikeMigrations, config.Database.AutoMigrate, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while checking database schema")
+	}
+
+	err = domain.PopulateDatabase(ctx, database)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while populate database")
+	}
+
+	ctx = storage.NewContext(ctx, database)
+	ctx = entropy.NewContext(ctx, entropy.NewIDGenerator())
+	service, err := transport.NewBikeService(ctx, m.ToMap(), config, *logger, statsd)
+	if err != nil {
+		return errors.Wrap(
+			err, "an error occured while initialising bike service")
+	}
+
+	listener, err := domain.ListenerToBikeEvent(ctx, config, *logger, database)
+	if err != nil {
+		return errors.Wrap(
+			err, "an error occured while initialising background listener service")
+	}
+
+	messenger, err := messaging.NewEmitter(ctx, Bike, config.Messaging.Emission, *logger, statsd)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating messenger")
+	}
+
+	relay := domain.NewOutboxRelay(config.Outbox, database, messenger, *logger)
+
+	return runServiceWithListener(ctx, config.Server, service, *logger,
+		[]messaging.Consumer{listener, relay},
+		func(ctx context.Context) {
 			database.Close(ctx)
+			closeTracer(tracer, *logger)
 		})
-	})
 }
 
 func gateway(c *cli.Context, m Metadata) error {
@@ -117,33 +181,64 @@ func gateway(c *cli.Context, m Metadata) error {
 				"an error occured while reading gateway configuration")
 		}
 
-		logger, statsd, err := createInfraTools(ctx, config.Logging, config.Monitoring)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while creating tools for infra")
-		}
-
-		messenger, err := messaging.NewEmitter(ctx, config.Messaging.Emission, *logger)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while creating messenger")
-		}
-
-		test := "test"
-		err = messenger.Emit(ctx, &test)
-		if err != nil {
-			return errors.Wrap(err,
-				"an error occured while publishing test message")
-		}
+		authFromContext(c, &config.Auth)
 
-		service, err := transport.NewGatewayService(ctx, m.ToMap(), *config, *logger, statsd, messenger)
-		if err != nil {
-			return errors.Wrap(
-				err, "an error occured while initialising gateway service")
-		}
-
-		ctx = entropy.NewContext(ctx, entropy.NewIDGenerator())
-		return runService(ctx, config.Server, service, *logger,
-			func(ctx context.Context) {})
+		return runGateway(ctx, *config, m)
 	})
 }
+
+// runGateway runs the gateway service until ctx is done.
+func runGateway(ctx context.Context, config configuration.GatewayConfiguration, m Metadata) error {
+	if !config.Auth.HasKey() {
+		return errors.New("no key configured to verify rider tokens, set AUTH_SECRET, AUTH_PUBLIC_KEY or AUTH_JWKS")
+	}
+
+	logger, statsd, err := createInfraTools(ctx, config.Logging, config.Monitoring)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating tools for infra")
+	}
+
+	tracer, err := tracing.NewTracer("gateway", config.Tracing, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating tracer")
+	}
+
+	ctx = tracing.NewContext(ctx, tracer)
+
+	messenger, err := messaging.NewEmitter(ctx, Gateway, config.Messaging.Emission, *logger, statsd)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating messenger")
+	}
+
+	workflows, err := storage.NewFileWorkflowLog(config.Workflows.Directory, *logger)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while opening workflow log")
+	}
+
+	upstreams, err := httpx.NewUpstreams(config, *logger, statsd)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while creating upstream clients")
+	}
+
+	ctx = httpx.NewContext(ctx, upstreams)
+	ctx = entropy.NewContext(ctx, entropy.NewIDGenerator())
+
+	service, err := transport.NewGatewayService(ctx, m.ToMap(), config, *logger, statsd, messenger, workflows)
+	if err != nil {
+		return errors.Wrap(
+			err, "an error occured while initialising gateway service")
+	}
+
+	recoverer := domain.NewWorkflowRecoverer(config, workflows, *logger)
+
+	return runServiceWithListener(ctx, config.Server, service, *logger,
+		[]messaging.Consumer{recoverer},
+		func(ctx context.Context) {
+			closeTracer(tracer, *logger)
+		})
+}
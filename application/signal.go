@@ -94,16 +94,16 @@ func runService(ctx context.Context, conf configuration.Server, server *http.Ser
 	return nil
 }
 
-// runService handles graceful shutdown of the http server with an additionnal background listener.
+// runService handles graceful shutdown of the http server with additionnal background listeners.
 func runServiceWithListener(ctx context.Context, conf configuration.Server, server *http.Server, logger logging.Logger,
-	listener messaging.Consumer,
+	listeners []messaging.Consumer,
 	onClose func(ctx context.Context)) error {
 	socket, err := net.Listen("tcp", conf.String())
 	if err != nil {
 		return errors.Wrapf(err, "cannot listen port: %d", conf.Port)
 	}
 
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 1+len(listeners))
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 
@@ -126,28 +126,32 @@ func runServiceWithListener(ctx context.Context, conf configuration.Server, serv
 		}
 	}()
 
-	logger.Infof("launching background listener")
-	go func() {
-		err := listener.Run(ctx)
-		if err != nil {
-			errChan <- errors.Wrap(err, "failed launching background listener")
-		}
-	}()
+	logger.Infof("launching %d background listeners", len(listeners))
+	for _, listener := range listeners {
+		go func(listener messaging.Consumer) {
+			err := listener.Run(ctx)
+			if err != nil {
+				errChan <- errors.Wrap(err, "failed launching background listener")
+			}
+		}(listener)
+	}
 
 	select {
 	case <-stop:
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
-		err = server.Shutdown(ctx)
-		if err != nil {
-			logger.WithError(err).Info("an error occured while shutting down server")
-		}
-		logger.Info("server gracefully stopping")
-
+	case <-ctx.Done():
+		// the services running along in the process are stopping.
 	case err := <-errChan:
 		return err
 	}
 
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.WithError(err).Info("an error occured while shutting down server")
+	}
+	logger.Info("server gracefully stopping")
+
 	logger.Warning("the server is shutting everything down")
 	onClose(ctx)
 
@@ -0,0 +1,123 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/EarvinKayonga/rider/configuration"
+)
+
+// standaloneDatabase keeps the data of the standalone services in memory.
+const standaloneDatabase = configuration.MemoryDriver + "://"
+
+// RunStandalone is a wrapper in order to keep the the main function tidy.
+func RunStandalone(args []string, m Metadata) error {
+	application := &Application{
+		&cli.App{
+			Name:      AppNameSpace + Standalone,
+			Author:    AppAuthor,
+			Copyright: AppCopyright,
+
+			EnableBashCompletion: true,
+
+			UsageText: "the bike, trip and gateway services in a single process",
+			Usage:     "Rider in a single process, with in-memory databases and messaging",
+
+			Version: fmt.Sprintf(
+				"Branch: %s, Compiler: %s, CompiledAt: %s, Commit: %s",
+				m.Branch, m.Compiler, m.CompiledAt, m.Sha),
+
+			Metadata: m.ToMap(),
+
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "bike-configuration",
+					Usage: "path to the configuration file of the bike service (yml)",
+					Value: "configuration.bike.yml",
+				},
+
+				cli.StringFlag{
+					Name:  "trip-configuration",
+					Usage: "path to the configuration file of the trip service (yml)",
+					Value: "configuration.trip.yml",
+				},
+
+				cli.StringFlag{
+					Name:  "gateway-configuration",
+					Usage: "path to the configuration file of the gateway service (yml)",
+					Value: "configuration.gateway.yml",
+				},
+			}, authFlags()...),
+
+			Action: func(c *cli.Context) error {
+				return standalone(c, m)
+			},
+		},
+	}
+
+	return application.Run(args)
+}
+
+// standalone runs the three services until one of them stops,
+// their messages going through the in-memory bus.
+func standalone(c *cli.Context, m Metadata) error {
+	return makeCancellable(func(ctx context.Context) error {
+		bikeConf, err := configuration.GetBikeConfiguration(
+			c.GlobalString("bike-configuration"), standaloneDatabase, "", "")
+		if err != nil {
+			return errors.Wrap(err,
+				"an error occured while reading bike configuration")
+		}
+
+		tripConf, err := configuration.GetTripConfiguration(
+			c.GlobalString("trip-configuration"), standaloneDatabase, "", "")
+		if err != nil {
+			return errors.Wrap(err,
+				"an error occured while reading trip configuration")
+		}
+
+		gatewayConf, err := configuration.GetGatewayConfiguration(
+			c.GlobalString("gateway-configuration"),
+			fmt.Sprintf("http://localhost:%d", bikeConf.Server.Port),
+			fmt.Sprintf("http://localhost:%d", tripConf.Server.Port), "")
+		if err != nil {
+			return errors.Wrap(err,
+				"an error occured while reading gateway configuration")
+		}
+
+		authFromContext(c, &gatewayConf.Auth)
+
+		bikeConf.Messaging.Consumption.Driver = configuration.MemoryDriver
+		tripConf.Messaging.Consumption.Driver = configuration.MemoryDriver
+		bikeConf.Messaging.Emission.Driver = configuration.MemoryDriver
+		tripConf.Messaging.Emission.Driver = configuration.MemoryDriver
+		gatewayConf.Messaging.Emission.Driver = configuration.MemoryDriver
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errs := make(chan error, 3)
+		run := func(service func() error) {
+			err := service()
+
+			// the others stop along.
+			cancel()
+			errs <- err
+		}
+
+		go run(func() error { return runBike(ctx, *bikeConf, m) })
+		go run(func() error { return runTrip(ctx, *tripConf, m) })
+		go run(func() error { return runGateway(ctx, *gatewayConf, m) })
+
+		for i := 0; i < cap(errs); i++ {
+			if serviceErr := <-errs; serviceErr != nil && err == nil {
+				err = serviceErr
+			}
+		}
+
+		return err
+	})
+}
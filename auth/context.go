@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+)
+
+// keyType is a package local type alias purposed to avoid name collision
+// in context.
+type keyType string
+
+const (
+	key = keyType("rider")
+)
+
+// RiderFromContext extracts the authenticated rider id from the Context,
+// empty when there is none.
+func RiderFromContext(ctx context.Context) string {
+	riderID, _ := ctx.Value(key).(string)
+	return riderID
+}
+
+// NewContext adds the given authenticated rider id to the Context.
+func NewContext(ctx context.Context, riderID string) context.Context {
+	return context.WithValue(ctx, key, riderID)
+}
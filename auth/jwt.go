@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/problem"
+)
+
+// Errors of token verification.
+var (
+	ErrMissingToken = problem.New("missing_token", http.StatusUnauthorized, "missing bearer token")
+	ErrInvalidToken = problem.New("invalid_token", http.StatusUnauthorized, "invalid token")
+	ErrExpiredToken = problem.New("expired_token", http.StatusUnauthorized, "expired token")
+)
+
+// Signing algorithms accepted.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// Claims are the registered claims of a token,
+// the subject being the rider id.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+}
+
+// audience is either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(data, &many)
+	if err != nil {
+		return err
+	}
+
+	*a = many
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, candidate := range a {
+		if candidate == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verifier validates the tokens signed with
+// the keys of the configuration.
+type Verifier struct {
+	secret   []byte
+	keys     map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier returns a Verifier of HS256 tokens when a secret is configured,
+// and of RS256 tokens when a public key or a JWKS file is.
+func NewVerifier(conf configuration.Auth) (*Verifier, error) {
+	verifier := &Verifier{
+		secret:   []byte(conf.Secret),
+		keys:     map[string]*rsa.PublicKey{},
+		issuer:   conf.Issuer,
+		audience: conf.Audience,
+		leeway:   conf.Leeway,
+		now:      time.Now,
+	}
+
+	if conf.PublicKey != "" {
+		key, err := readPublicKey(conf.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		verifier.keys[""] = key
+	}
+
+	if conf.JWKS != "" {
+		keys, err := readJWKS(conf.JWKS)
+		if err != nil {
+			return nil, err
+		}
+
+		for kid, key := range keys {
+			verifier.keys[kid] = key
+		}
+	}
+
+	if len(verifier.secret) == 0 && len(verifier.keys) == 0 {
+		return nil, errors.New("no key configured to verify tokens")
+	}
+
+	return verifier, nil
+}
+
+// Verify checks the signature and validity of a token,
+// returning its claims.
+func (e *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	h := header{}
+	err := decodeSegment(parts[0], &h)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = e.verifySignature(h, parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	err = decodeSegment(parts[1], claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = e.validate(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (e *Verifier) verifySignature(h header, signed string, signature []byte) error {
+	switch h.Algorithm {
+	case HS256:
+		if len(e.secret) == 0 {
+			return ErrInvalidToken
+		}
+
+		mac := hmac.New(sha256.New, e.secret)
+		_, _ = mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrInvalidToken
+		}
+
+		return nil
+
+	case RS256:
+		key := e.publicKey(h.KeyID)
+		if key == nil {
+			return ErrInvalidToken
+		}
+
+		digest := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidToken
+		}
+
+		return nil
+
+	default:
+		// none and the algorithms not configured.
+		return ErrInvalidToken
+	}
+}
+
+// publicKey returns the key of kid, the configured public key,
+// or the only key when the token names none.
+func (e *Verifier) publicKey(kid string) *rsa.PublicKey {
+	if key, ok := e.keys[kid]; ok {
+		return key
+	}
+
+	if key, ok := e.keys[""]; ok {
+		return key
+	}
+
+	if kid == "" && len(e.keys) == 1 {
+		for _, key := range e.keys {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (e *Verifier) validate(claims *Claims) error {
+	now := e.now()
+
+	if claims.Subject == "" || claims.ExpiresAt == 0 {
+		return ErrInvalidToken
+	}
+
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(e.leeway)) {
+		return ErrExpiredToken
+	}
+
+	if claims.NotBefore != 0 && now.Add(e.leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return ErrInvalidToken
+	}
+
+	if e.issuer != "" && claims.Issuer != e.issuer {
+		return ErrInvalidToken
+	}
+
+	if e.audience != "" && !claims.Audience.contains(e.audience) {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
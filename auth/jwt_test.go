@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EarvinKayonga/rider/configuration"
+)
+
+const testSecret = "test-secret"
+
+var testNow = time.Unix(1700000000, 0)
+
+func segment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret []byte, h header, claims interface{}) string {
+	signed := segment(t, h) + "." + segment(t, claims)
+
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, h header, claims interface{}) string {
+	signed := segment(t, h) + "." + segment(t, claims)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// claims returns valid claims of rider-1, overridden by fields.
+func claims(fields map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"sub": "rider-1",
+		"iss": "rider-issuer",
+		"aud": "rider-gateway",
+		"exp": testNow.Add(time.Hour).Unix(),
+	}
+
+	for k, v := range fields {
+		if v == nil {
+			delete(c, k)
+			continue
+		}
+
+		c[k] = v
+	}
+
+	return c
+}
+
+// writePublicKey writes the PEM public key of key in dir.
+func writePublicKey(t *testing.T, dir string, key *rsa.PrivateKey) (string, []byte) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	path := filepath.Join(dir, "public.pem")
+
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path, data
+}
+
+func newTestVerifier(t *testing.T, conf configuration.Auth) *Verifier {
+	conf.Issuer = "rider-issuer"
+	conf.Audience = "rider-gateway"
+	conf.Leeway = 30 * time.Second
+
+	verifier, err := NewVerifier(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier.now = func() time.Time { return testNow }
+	return verifier
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, publicPEM := writePublicKey(t, dir, key)
+
+	hmacOnly := newTestVerifier(t, configuration.Auth{Secret: testSecret})
+	rsaOnly := newTestVerifier(t, configuration.Auth{PublicKey: publicKey})
+
+	hs256 := header{Algorithm: HS256}
+	rs256 := header{Algorithm: RS256}
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+		err      error
+	}{
+		{
+			name:     "valid HS256",
+			verifier: hmacOnly,
+			token:    signHS256(t, []byte(testSecret), hs256, claims(nil)),
+		},
+		{
+			name:     "valid RS256",
+			verifier: rsaOnly,
+			token:    signRS256(t, key, rs256, claims(nil)),
+		},
+		{
+			name:     "HS256 signed with another secret",
+			verifier: hmacOnly,
+			token:    signHS256(t, []byte("another-secret"), hs256, claims(nil)),
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "RS256 signed with another key",
+			verifier: rsaOnly,
+			token:    signRS256(t, other, rs256, claims(nil)),
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "HS256 signed with the public key of an RS256 verifier",
+			verifier: rsaOnly,
+			token:    signHS256(t, publicPEM, hs256, claims(nil)),
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "RS256 on an HS256 verifier",
+			verifier: hmacOnly,
+			token:    signRS256(t, key, rs256, claims(nil)),
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "none algorithm",
+			verifier: hmacOnly,
+			token:    segment(t, header{Algorithm: "none"}) + "." + segment(t, claims(nil)) + ".",
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "tampered claims",
+			verifier: hmacOnly,
+			token: func() string {
+				valid := signHS256(t, []byte(testSecret), hs256, claims(nil))
+				forged := signHS256(t, []byte(testSecret), hs256, claims(map[string]interface{}{"sub": "rider-2"}))
+
+				return forged[:len(forged)-43] + valid[len(valid)-43:]
+			}(),
+			err: ErrInvalidToken,
+		},
+		{
+			name:     "malformed token",
+			verifier: hmacOnly,
+			token:    "not.a-token",
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "expired",
+			verifier: hmacOnly,
+			token: signHS256(t, []byte(testSecret), hs256,
+				claims(map[string]interface{}{"exp": testNow.Add(-time.Minute).Unix()})),
+			err: ErrExpiredToken,
+		},
+		{
+			name:     "expired within leeway",
+			verifier: hmacOnly,
+			token: signHS256(t, []byte(testSecret), hs256,
+				claims(map[string]interface{}{"exp": testNow.Add(-10 * time.Second).Unix()})),
+		},
+		{
+			name:     "without exp",
+			verifier: hmacOnly,
+			token:    signHS256(t, []byte(testSecret), hs256, claims(map[string]interface{}{"exp": nil})),
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "not yet valid",
+			verifier: hmacOnly,
+			token: signHS256(t, []byte(testSecret), hs256,
+				claims(map[string]interface{}{"nbf": testNow.Add(time.Minute).Unix()})),
+			err: ErrInvalidToken,
+		},
+		{
+			name:     "not yet valid within leeway",
+			verifier: hmacOnly,
+			token: signHS256(t, []byte(testSecret), hs256,
+				claims(map[string]interface{}{"nbf": testNow.Add(10 * time.Second).Unix()})),
+		},
+		{
+			name:     "another issuer",
+			verifier: hmacOnly,
+			token:    signHS256(t, []byte(testSecret), hs256, claims(map[string]interface{}{"iss": "someone"})),
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "another audience",
+			verifier: hmacOnly,
+			token:    signHS256(t, []byte(testSecret), hs256, claims(map[string]interface{}{"aud": "someone"})),
+			err:      ErrInvalidToken,
+		},
+		{
+			name:     "audience among others",
+			verifier: hmacOnly,
+			token: signHS256(t, []byte(testSecret), hs256,
+				claims(map[string]interface{}{"aud": []string{"someone", "rider-gateway"}})),
+		},
+		{
+			name:     "without subject",
+			verifier: hmacOnly,
+			token:    signHS256(t, []byte(testSecret), hs256, claims(map[string]interface{}{"sub": nil})),
+			err:      ErrInvalidToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := test.verifier.Verify(test.token)
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if err == nil && claims.Subject != "rider-1" {
+				t.Fatalf("expected subject rider-1, got %s", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestNewVerifierWithoutKey(t *testing.T) {
+	_, err := NewVerifier(configuration.Auth{})
+	if err == nil {
+		t.Fatal("expected an error without key")
+	}
+}
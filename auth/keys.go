@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// readPublicKey reads an RSA public key from a PEM file,
+// either PKIX, PKCS1 or a certificate.
+func readPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while reading public key: %s", path)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("no pem block found in %s", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var certificate *x509.Certificate
+		certificate, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = certificate.PublicKey
+		}
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while parsing public key: %s", path)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("public key of %s is not an RSA key", path)
+	}
+
+	return rsaKey, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+// readJWKS reads the RSA signing keys of a JSON Web Key Set file,
+// by key id.
+func readJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while reading jwks: %s", path)
+	}
+
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while decoding jwks: %s", path)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid modulus of key %s", k.KeyID)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.Errorf("invalid exponent of key %s", k.KeyID)
+		}
+
+		keys[k.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.Errorf("no RSA signing key found in %s", path)
+	}
+
+	return keys, nil
+}
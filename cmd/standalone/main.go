@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/EarvinKayonga/rider/application"
+)
+
+func main() {
+	err := application.RunStandalone(
+		os.Args,
+		application.Metadata{
+			Branch:     branch,
+			Compiler:   compiler,
+			CompiledAt: compiledAt,
+			Sha:        sha,
+		},
+	)
+	if err != nil {
+		log.Fatalf("%v occured with %v", err, os.Args)
+	}
+}
+
+var (
+	branch     string
+	sha        string
+	compiledAt string
+	compiler   string
+)
@@ -3,7 +3,9 @@ package configuration
 import (
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
@@ -37,14 +39,29 @@ func GetGatewayConfiguration(path, bikeURL, tripURL string, nsq string) (*Gatewa
 
 	config := &GatewayConfiguration{
 		Server: Server{
-			Port: 8080,
+			Port:    8080,
+			Timeout: DefaultRequestTimeout,
 		},
 
+		Tracing: DefaultTracing,
+		Limiter: DefaultLimiter,
+
 		Logging: Logging{
 			Level: "debug",
 		},
+
+		Workflows: Workflows{
+			Directory:           "workflows",
+			RecoveryInterval:    30 * time.Second,
+			StaleAfter:          time.Minute,
+			CompensationTimeout: 10 * time.Second,
+		},
 	}
 
+	config.Upstreams.Bike = DefaultUpstream
+	config.Upstreams.Trip = DefaultUpstream
+	config.Messaging.Emission.Spool = DefaultSpool
+
 	err = viper.Unmarshal(config)
 	if err != nil {
 		return nil, errors.Wrapf(err,
@@ -69,7 +86,7 @@ func GetGatewayConfiguration(path, bikeURL, tripURL string, nsq string) (*Gatewa
 }
 
 // GetBikeConfiguration returns valid configuration to run a bike service.
-func GetBikeConfiguration(path, databaseURL, consumerSOCKET string) (*BikeConfiguration, error) {
+func GetBikeConfiguration(path, databaseURL, consumerSOCKET, producerSOCKET string) (*BikeConfiguration, error) {
 	err := loadConfiguration(path)
 	if err != nil {
 		return nil, errors.Wrap(err,
@@ -78,14 +95,24 @@ func GetBikeConfiguration(path, databaseURL, consumerSOCKET string) (*BikeConfig
 
 	config := &BikeConfiguration{
 		Server: Server{
-			Port: 8081,
+			Port:    8081,
+			Timeout: DefaultRequestTimeout,
 		},
 
+		Tracing: DefaultTracing,
+
 		Logging: Logging{
 			Level: "debug",
 		},
 	}
 
+	config.Messaging.Consumption.Channel = "bike"
+	config.Messaging.Consumption.Retry = DefaultConsumerRetry
+
+	// events are only marked sent once nsqd acknowledged them.
+	config.Messaging.Emission.Acknowledged = true
+	config.Outbox = DefaultOutbox
+
 	err = viper.Unmarshal(config)
 	if err != nil {
 		return nil, errors.Wrapf(err,
@@ -93,7 +120,7 @@ func GetBikeConfiguration(path, databaseURL, consumerSOCKET string) (*BikeConfig
 	}
 
 	if databaseURL != "" {
-		database, err := parseDatabaseURL(databaseURL)
+		database, err := parseDatabaseURL(databaseURL, config.Database)
 		if err != nil {
 			return nil, errors.Wrapf(err, "an error occured while parsing database url: %s", databaseURL)
 		}
@@ -105,11 +132,16 @@ func GetBikeConfiguration(path, databaseURL, consumerSOCKET string) (*BikeConfig
 		config.Messaging.Consumption.Address = consumerSOCKET
 	}
 
+	if producerSOCKET != "" {
+		config.Messaging.Consumption.DeadLetter.Address = producerSOCKET
+		config.Messaging.Emission.Address = producerSOCKET
+	}
+
 	return config, nil
 }
 
 // GetTripConfiguration returns valid configuration to run a trip service.
-func GetTripConfiguration(path, databaseURL, consumerSOCKET string) (*TripConfiguration, error) {
+func GetTripConfiguration(path, databaseURL, consumerSOCKET, producerSOCKET string) (*TripConfiguration, error) {
 	err := loadConfiguration(path)
 	if err != nil {
 		return nil, errors.Wrap(err,
@@ -118,14 +150,24 @@ func GetTripConfiguration(path, databaseURL, consumerSOCKET string) (*TripConfig
 
 	config := &TripConfiguration{
 		Server: Server{
-			Port: 8082,
+			Port:    8082,
+			Timeout: DefaultRequestTimeout,
 		},
 
+		Tracing: DefaultTracing,
+
 		Logging: Logging{
 			Level: "debug",
 		},
 	}
 
+	config.Messaging.Consumption.Channel = "trip"
+	config.Messaging.Consumption.Retry = DefaultConsumerRetry
+
+	// events are only marked sent once nsqd acknowledged them.
+	config.Messaging.Emission.Acknowledged = true
+	config.Outbox = DefaultOutbox
+
 	err = viper.Unmarshal(config)
 	if err != nil {
 		return nil, errors.Wrapf(err,
@@ -133,7 +175,7 @@ func GetTripConfiguration(path, databaseURL, consumerSOCKET string) (*TripConfig
 	}
 
 	if databaseURL != "" {
-		database, err := parseDatabaseURL(databaseURL)
+		database, err := parseDatabaseURL(databaseURL, config.Database)
 		if err != nil {
 			return nil, errors.Wrapf(err, "an error occured while parsing database url: %s", databaseURL)
 		}
@@ -145,15 +187,27 @@ func GetTripConfiguration(path, databaseURL, consumerSOCKET string) (*TripConfig
 		config.Messaging.Consumption.Address = consumerSOCKET
 	}
 
+	if producerSOCKET != "" {
+		config.Messaging.Consumption.DeadLetter.Address = producerSOCKET
+		config.Messaging.Emission.Address = producerSOCKET
+	}
+
 	return config, nil
 }
 
-func parseDatabaseURL(databaseURL string) (*Database, error) {
+// parseDatabaseURL overwrites the connection settings of base
+// with the ones found in databaseURL.
+func parseDatabaseURL(databaseURL string, base Database) (*Database, error) {
 	u, err := url.Parse(databaseURL)
 	if err != nil {
 		return nil, errors.Wrapf(err, "an error occured while parsing database url: %s", databaseURL)
 	}
 
+	if u.Scheme == MemoryDriver {
+		base.Driver = MemoryDriver
+		return &base, nil
+	}
+
 	password, ok := u.User.Password()
 	if !ok {
 		password = ""
@@ -170,11 +224,83 @@ func parseDatabaseURL(databaseURL string) (*Database, error) {
 		port = "5432"
 	}
 
-	return &Database{
-		Host:     host,
-		Port:     port,
-		User:     u.User.Username(),
-		Password: password,
-		Name:     strings.TrimLeft(u.Path, "/"),
-	}, nil
+	base.Driver = PostgresDriver
+	base.Host = host
+	base.Port = port
+	base.User = u.User.Username()
+	base.Password = password
+	base.Name = strings.TrimLeft(u.Path, "/")
+
+	err = parseDatabaseOptions(u.Query(), &base)
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while parsing options of database url")
+	}
+
+	return &base, nil
+}
+
+// parseDatabaseOptions overwrites the settings of database
+// with the ones given as query parameters of a database url.
+func parseDatabaseOptions(query url.Values, database *Database) error {
+	texts := map[string]*string{
+		"sslmode":     &database.SSLMode,
+		"sslrootcert": &database.SSLRootCert,
+		"sslcert":     &database.SSLCert,
+		"sslkey":      &database.SSLKey,
+	}
+
+	for key, value := range texts {
+		if query.Get(key) != "" {
+			*value = query.Get(key)
+		}
+	}
+
+	ints := map[string]*int{
+		"max_open_conns": &database.MaxOpenConns,
+		"max_idle_conns": &database.MaxIdleConns,
+	}
+
+	for key, value := range ints {
+		if query.Get(key) == "" {
+			continue
+		}
+
+		i, err := strconv.Atoi(query.Get(key))
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", key)
+		}
+
+		*value = i
+	}
+
+	durations := map[string]*time.Duration{
+		"conn_max_lifetime": &database.ConnMaxLifetime,
+		"statement_timeout": &database.StatementTimeout,
+	}
+
+	for key, value := range durations {
+		if query.Get(key) == "" {
+			continue
+		}
+
+		d, err := parseDuration(query.Get(key))
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", key)
+		}
+
+		*value = d
+	}
+
+	return nil
+}
+
+// parseDuration reads a duration, a bare integer being
+// milliseconds as postgres reads them.
+func parseDuration(value string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+
+	return time.ParseDuration(value)
 }
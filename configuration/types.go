@@ -3,6 +3,8 @@ package configuration
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // TripConfiguration specifies general configurations
@@ -11,11 +13,17 @@ type TripConfiguration struct {
 	Server     Server
 	Logging    Logging
 	Monitoring Monitoring
+	Tracing    Tracing
 
 	Database  Database
 	Messaging struct {
 		Consumption Consumption
+
+		// Emission publishes the events of the outbox.
+		Emission Emission
 	}
+
+	Outbox Outbox
 }
 
 // BikeConfiguration specifies general configurations
@@ -24,11 +32,17 @@ type BikeConfiguration struct {
 	Server     Server
 	Logging    Logging
 	Monitoring Monitoring
+	Tracing    Tracing
 
 	Database  Database
 	Messaging struct {
 		Consumption Consumption
+
+		// Emission publishes the events of the outbox.
+		Emission Emission
 	}
+
+	Outbox Outbox
 }
 
 // GatewayConfiguration specifies general configurations
@@ -37,6 +51,7 @@ type GatewayConfiguration struct {
 	Server     Server
 	Logging    Logging
 	Monitoring Monitoring
+	Tracing    Tracing
 	Limiter    Limiter
 
 	Messaging struct {
@@ -48,6 +63,141 @@ type GatewayConfiguration struct {
 
 	// TripURL is the base url to trip service.
 	TripURL string
+
+	Auth Auth
+
+	// Upstreams configures the http clients
+	// of the bike and trip services.
+	Upstreams struct {
+		Bike Upstream
+		Trip Upstream
+	}
+
+	Workflows Workflows
+}
+
+// Auth configures the authentication of riders
+// with JWT bearer tokens, whose subject is the rider id.
+type Auth struct {
+	// Secret verifies HS256 tokens.
+	Secret string
+
+	// PublicKey is a PEM file, and JWKS a JSON Web Key Set file,
+	// of the keys verifying RS256 tokens.
+	PublicKey string
+	JWKS      string
+
+	// Issuer and Audience are checked when set.
+	Issuer   string
+	Audience string
+
+	// Leeway tolerates clock skew on exp and nbf.
+	Leeway time.Duration
+}
+
+// HasKey tells whether a key verifying tokens is configured.
+func (a Auth) HasKey() bool {
+	return a.Secret != "" || a.PublicKey != "" || a.JWKS != ""
+}
+
+// Upstream configures the http client of a service
+// called by the gateway.
+type Upstream struct {
+	// Timeout bounds a whole request, response body included.
+	Timeout             time.Duration
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+
+	// Connection pool settings.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// CACert verifies the upstream certificate, instead of the system roots.
+	// Certificate and PrivateKey authenticate the gateway to the upstream.
+	CACert             string
+	Certificate        string
+	PrivateKey         string
+	InsecureSkipVerify bool
+
+	Retry   Retry
+	Breaker Breaker
+}
+
+// Retry configures the retries of idempotent upstream calls,
+// waiting a random delay up to BaseDelay * 2^retry, capped by MaxDelay,
+// and the retries of consumed messages.
+type Retry struct {
+	// Attempts counts the first call, 1 disabling retries.
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Breaker configures the circuit breaker of an upstream.
+type Breaker struct {
+	// ConsecutiveFailures opens the breaker.
+	ConsecutiveFailures uint32
+	// OpenTimeout is spent open before letting
+	// HalfOpenRequests probe the upstream.
+	OpenTimeout      time.Duration
+	HalfOpenRequests uint32
+}
+
+// DefaultUpstream is the configuration of an upstream
+// when none is given.
+var DefaultUpstream = Upstream{
+	Timeout:             10 * time.Second,
+	DialTimeout:         5 * time.Second,
+	TLSHandshakeTimeout: 5 * time.Second,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+	Retry: Retry{
+		Attempts:  3,
+		BaseDelay: 50 * time.Millisecond,
+		MaxDelay:  time.Second,
+	},
+	Breaker: Breaker{
+		ConsecutiveFailures: 5,
+		OpenTimeout:         30 * time.Second,
+		HalfOpenRequests:    1,
+	},
+}
+
+// Workflows configures the log of the trip workflows
+// orchestrated by the gateway.
+type Workflows struct {
+	// Directory holds one file per workflow in progress.
+	Directory string
+
+	// RecoveryInterval is the period of the recovery loop,
+	// which resumes the workflows not updated for StaleAfter.
+	RecoveryInterval time.Duration
+	StaleAfter       time.Duration
+
+	// CompensationTimeout bounds the rollback of a workflow
+	// whose request failed, which outlives the request.
+	CompensationTimeout time.Duration
+}
+
+// Outbox configures the relay of the events
+// written in the database along the changes they describe.
+type Outbox struct {
+	// PollInterval is the period of the relay,
+	// which sends up to BatchSize pending events at a time.
+	PollInterval time.Duration
+	BatchSize    int64
+
+	// Retention is how long the sent events are kept.
+	Retention time.Duration
+}
+
+// DefaultOutbox is the relay of a service when none is configured.
+var DefaultOutbox = Outbox{
+	PollInterval: time.Second,
+	BatchSize:    100,
+	Retention:    7 * 24 * time.Hour,
 }
 
 // Server specifies http based configuration for the underlying server.
@@ -56,6 +206,25 @@ type Server struct {
 	Certificate string
 	PrivateKey  string
 	Host        string
+
+	// Timeout bounds the handling of a request, upstream
+	// and database calls included, unless Timeouts
+	// overrides it for the route name.
+	Timeout  time.Duration
+	Timeouts map[string]time.Duration
+}
+
+// DefaultRequestTimeout bounds the handling of a request
+// when no timeout is configured.
+const DefaultRequestTimeout = 10 * time.Second
+
+// TimeoutFor returns the timeout of a route.
+func (s Server) TimeoutFor(route string) time.Duration {
+	if timeout, ok := s.Timeouts[strings.ToLower(route)]; ok {
+		return timeout
+	}
+
+	return s.Timeout
 }
 
 // String for Stringer interface.
@@ -63,6 +232,38 @@ func (s Server) String() string {
 	return fmt.Sprintf("%s:%s", s.Host, strconv.FormatInt(int64(s.Port), 10))
 }
 
+// Exporters of spans.
+const (
+	NoExporter     = "none"
+	StdoutExporter = "stdout"
+	OTLPExporter   = "otlp"
+)
+
+// Tracing configures the export of spans.
+type Tracing struct {
+	// Exporter is either stdout or otlp,
+	// spans being only propagated otherwise.
+	Exporter string
+	// Endpoint is the base url of an OTLP/HTTP collector,
+	// such as http://localhost:4318.
+	Endpoint string
+
+	// SampleRatio is the share of new traces exported,
+	// within [0, 1]. Continued traces follow their parent.
+	SampleRatio float64
+
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// DefaultTracing is the tracing configuration
+// when none is given.
+var DefaultTracing = Tracing{
+	SampleRatio:   1,
+	BatchSize:     512,
+	FlushInterval: 5 * time.Second,
+}
+
 // Logging holds log configuration.
 type Logging struct {
 	// Standard log level
@@ -85,6 +286,17 @@ const (
 	JSONFormat = "json"
 )
 
+// Supported database drivers.
+const (
+	// PostgresDriver persists data in a postgres instance.
+	PostgresDriver = "postgres"
+
+	// MemoryDriver keeps data in memory, and as a messaging driver
+	// passes messages through channels between the services
+	// of a process, for local development and tests.
+	MemoryDriver = "memory"
+)
+
 // Monitoring holds monitoring configuration.
 // (for things, like statsd or else).
 type Monitoring struct {
@@ -92,31 +304,266 @@ type Monitoring struct {
 	Prefix string
 }
 
-// Limiter for rate limit features.
+// Limiter for rate limit features: each client has a token bucket
+// refilled at Limit tokens per second and holding up to Burst tokens.
 type Limiter struct {
 	Limit float64
 	Burst int
+
+	// Key identifies the clients: ip, rider or api_key.
+	// Requests without rider or api key are limited by ip.
+	Key string
+
+	// APIKeyHeader carries the api key of the clients,
+	// one of APIKeys, other keys being limited by ip.
+	APIKeyHeader string
+	APIKeys      []string
+
+	// TrustForwardedFor reads the client ip from X-Forwarded-For,
+	// when the gateway stands behind a proxy. TrustedProxies are
+	// the ips or networks of the proxies, the peer of the gateway
+	// being the only one when empty.
+	TrustForwardedFor bool
+	TrustedProxies    []string
+
+	// Size bounds the buckets kept in memory,
+	// the least recently used being evicted.
+	Size int
+
+	// Routes overrides Limit and Burst for a route name,
+	// the route then having buckets of its own.
+	Routes map[string]RateLimit
+
+	// Unauthenticated limits by ip, before their token is verified,
+	// the requests of the routes limited by rider.
+	Unauthenticated RateLimit
+}
+
+// RateLimit is the policy of a token bucket.
+type RateLimit struct {
+	Limit float64
+	Burst int
+}
+
+// Keys identifying the clients of the rate limiter.
+const (
+	LimiterKeyIP     = "ip"
+	LimiterKeyRider  = "rider"
+	LimiterKeyAPIKey = "api_key"
+)
+
+// DefaultLimiter is the rate limiting configuration
+// when none is given.
+var DefaultLimiter = Limiter{
+	Limit:        10,
+	Burst:        20,
+	Key:          LimiterKeyIP,
+	APIKeyHeader: "X-API-Key",
+	Size:         10000,
+
+	Unauthenticated: RateLimit{
+		Limit: 50,
+		Burst: 100,
+	},
+}
+
+// PolicyFor returns the policy of a route, and whether
+// the route has one of its own.
+func (l Limiter) PolicyFor(route string) (RateLimit, bool) {
+	if policy, ok := l.Routes[strings.ToLower(route)]; ok {
+		return policy, true
+	}
+
+	return RateLimit{
+		Limit: l.Limit,
+		Burst: l.Burst,
+	}, false
 }
 
 // Database configuration.
 type Database struct {
+	// Driver selects the Store implementation,
+	// postgres (default) or memory.
+	Driver string
+
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Name     string
+
+	// SSLMode is one of disable (default), require,
+	// verify-ca or verify-full.
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	// Connection pool settings,
+	// zero keeps the database/sql defaults.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// StatementTimeout aborts longer statements,
+	// zero disables it.
+	StatementTimeout time.Duration
+
+	// AutoMigrate applies pending migrations at startup,
+	// instead of refusing to start.
+	AutoMigrate bool
+}
+
+// DSN returns the connection string of a postgres database.
+func (d Database) DSN() string {
+	sslMode := d.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	options := [][2]string{
+		{"host", d.Host},
+		{"port", d.Port},
+		{"user", d.User},
+		{"password", d.Password},
+		{"dbname", d.Name},
+		{"sslmode", sslMode},
+		{"sslrootcert", d.SSLRootCert},
+		{"sslcert", d.SSLCert},
+		{"sslkey", d.SSLKey},
+	}
+
+	if d.StatementTimeout > 0 {
+		// sent as a run-time parameter, in milliseconds.
+		options = append(options, [2]string{"statement_timeout",
+			strconv.FormatInt(int64(d.StatementTimeout/time.Millisecond), 10)})
+	}
+
+	pairs := []string{}
+	for _, option := range options {
+		if option[1] == "" {
+			continue
+		}
+
+		pairs = append(pairs, option[0]+"="+quoteDSNValue(option[1]))
+	}
+
+	return strings.Join(pairs, " ")
 }
 
+// quoteDSNValue escapes a value of a key=value connection string.
+func quoteDSNValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `'`, `\'`, -1)
+
+	return "'" + value + "'"
+}
+
+// NSQDriver is the messaging driver going through
+// nsqd and nsqlookupd (default).
+const NSQDriver = "nsq"
+
 // Emission for messaging.
 type Emission struct {
+	// Driver selects the backend, NSQDriver or MemoryDriver.
+	Driver string
+
 	Address     string
 	MaxInFlight int
 	Topic       string
+
+	// Acknowledged waits for nsqd to acknowledge each message,
+	// instead of publishing in the background.
+	Acknowledged bool
+
+	// Spool keeps the messages nsqd could not acknowledge,
+	// which implies Acknowledged.
+	Spool Spool
+}
+
+// Spool configures the write-ahead file of the messages emitted
+// while the broker is unreachable, published in order once it is back.
+type Spool struct {
+	// Directory holds the spool, disabled when empty.
+	Directory string
+
+	// MaxSize bounds the spool, in bytes.
+	MaxSize int64
+
+	// DrainInterval is the period of the attempts to publish the spool.
+	DrainInterval time.Duration
+}
+
+// DefaultSpool is the spool of an emission when none is configured.
+var DefaultSpool = Spool{
+	MaxSize:       64 << 20,
+	DrainInterval: time.Second,
 }
 
 // Consumption for messaging.
 type Consumption struct {
+	// Driver selects the backend, NSQDriver or MemoryDriver.
+	Driver string
+
 	Address string
 
 	Topic string
+
+	// Channel names the consumers of a service: every channel
+	// receives all the messages of the topic, which are shared
+	// by the consumers of the channel.
+	Channel string
+
+	// BatchSize and BatchInterval bound the batches of messages
+	// handled together: a batch is handled once full,
+	// or BatchInterval after its first message.
+	BatchSize     int
+	BatchInterval time.Duration
+
+	// Retry requeues the messages whose handling failed,
+	// waiting BaseDelay * 2^(attempt-1) capped by MaxDelay,
+	// until their last attempt sends them to the DeadLetter topic.
+	Retry      Retry
+	DeadLetter DeadLetter
+}
+
+// DeadLetterTopic returns the topic of the messages given up on.
+func (c Consumption) DeadLetterTopic() string {
+	if c.DeadLetter.Topic != "" {
+		return c.DeadLetter.Topic
+	}
+
+	return c.Topic + DeadLetterSuffix
+}
+
+// DeadLetter configures the topic of the messages given up on.
+type DeadLetter struct {
+	// Address is the nsqd publishing the dead letters.
+	Address string
+
+	// Topic defaults to the consumed topic with DeadLetterSuffix.
+	Topic string
+
+	// Channel is read by the dlq commands.
+	Channel string
+}
+
+// Batch defaults of a Consumption.
+const (
+	DefaultBatchSize     = 100
+	DefaultBatchInterval = time.Second
+)
+
+// Dead letter defaults of a Consumption.
+const (
+	DeadLetterSuffix         = ".dead"
+	DefaultDeadLetterChannel = "dlq"
+)
+
+// DefaultConsumerRetry is the retry of the consumed
+// messages when none is configured.
+var DefaultConsumerRetry = Retry{
+	Attempts:  5,
+	BaseDelay: time.Second,
+	MaxDelay:  5 * time.Minute,
 }
@@ -3,6 +3,8 @@ package domain
 import (
 	"context"
 
+	"github.com/pkg/errors"
+
 	"github.com/EarvinKayonga/rider/models"
 	"github.com/EarvinKayonga/rider/storage"
 )
@@ -14,6 +16,14 @@ func ListOfBikes(ctx context.Context, cursor string, limit int64) ([]models.Bike
 		ListBikes(ctx, cursor, limit)
 }
 
+// ListBikesNear lists bikes within radius meters of a location,
+// closest first.
+func ListBikesNear(ctx context.Context, lat, lng, radius float64, limit int64) ([]models.NearbyBike, error) {
+	return storage.
+		BikeStoreFromContext(ctx).
+		ListBikesNear(ctx, lat, lng, radius, limit)
+}
+
 // GetBikeByID returns a bike given an valid ID.
 func GetBikeByID(ctx context.Context, bikeID string) (*models.Bike, error) {
 	return storage.
@@ -22,10 +32,20 @@ func GetBikeByID(ctx context.Context, bikeID string) (*models.Bike, error) {
 }
 
 // LockBikeByID locks a bike given an valid ID.
+// Only one of concurrent callers gets the bike,
+// the others get ErrBikeInUse.
 func LockBikeByID(ctx context.Context, bikeID string) (*models.Bike, error) {
-	return storage.
+	bike, err := storage.
 		BikeStoreFromContext(ctx).
 		LockBikeByPublicID(ctx, bikeID)
+	if errors.Cause(err) == storage.ErrIllegalTransition {
+		current, thr := GetBikeByID(ctx, bikeID)
+		if thr == nil && current.Status == models.BikeInUse {
+			return nil, ErrBikeInUse
+		}
+	}
+
+	return bike, err
 }
 
 // UnLockBikeByID unlocks a bike given an valid ID.
@@ -34,3 +54,20 @@ func UnLockBikeByID(ctx context.Context, bikeID string) (*models.Bike, error) {
 		BikeStoreFromContext(ctx).
 		UnLockBikeByPublicID(ctx, bikeID)
 }
+
+// SetBikeStatus moves a bike to the given status,
+// when its current status allows it.
+func SetBikeStatus(ctx context.Context, bikeID string, status models.BikeStatus) (*models.Bike, error) {
+	store := storage.BikeStoreFromContext(ctx)
+
+	bike, err := store.FindBikeByPublicID(ctx, bikeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bike.Status.CanTransitionTo(status) {
+		return nil, storage.ErrIllegalTransition
+	}
+
+	return store.SetBikeStatus(ctx, bikeID, status)
+}
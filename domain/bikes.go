@@ -3,12 +3,22 @@ package domain
 import (
 	"context"
 	"encoding/json"
+	"regexp"
 
 	"github.com/pkg/errors"
 
+	"github.com/EarvinKayonga/rider/models"
 	"github.com/EarvinKayonga/rider/storage"
 )
 
+// bikeIDPattern matches the ids of the bikes registry.
+var bikeIDPattern = regexp.MustCompile(`^[0-9a-v]{20}$`)
+
+// IsValidBikeID tells whether id is an id of the bikes registry.
+func IsValidBikeID(id string) bool {
+	return bikeIDPattern.MatchString(id)
+}
+
 // PopulateDatabase put stuff in Database if empty
 func PopulateDatabase(ctx context.Context, db storage.BikeStore) error {
 	bikes, err := db.ListAllBikes(ctx, 1)
@@ -44,11 +54,12 @@ func fromRegistry() ([]storage.Bike, error) {
 	bikes := []storage.Bike{}
 	for index, b := range array {
 		bike := storage.Bike{
-			ID:        int64(index),
-			PublicID:  b.ID,
-			Status:    1,
-			Latitude:  b.Location.Coordinates[0],
-			Longitude: b.Location.Coordinates[1],
+			ID:       int64(index),
+			PublicID: b.ID,
+			Status:   models.BikeAvailable,
+			// the registry follows GeoJSON: [longitude, latitude].
+			Latitude:  b.Location.Coordinates[1],
+			Longitude: b.Location.Coordinates[0],
 		}
 
 		bikes = append(bikes, bike)
@@ -1,12 +1,28 @@
 package domain
 
 import (
-	"github.com/pkg/errors"
+	"net/http"
+
+	"github.com/EarvinKayonga/rider/problem"
 )
 
 // Domain based errors.
 var (
-	ErrBikeInUse  = errors.New("bike already in use")
-	ErrEmptyBody  = errors.New("empty body")
-	ErrUnexpected = errors.New("unexpected error")
+	ErrBikeInUse  = problem.New("bike_in_use", http.StatusConflict, "bike already in use")
+	ErrEmptyBody  = problem.New("empty_body", http.StatusBadGateway, "empty body")
+	ErrUnexpected = problem.New("unexpected", http.StatusInternalServerError, "unexpected error")
+
+	ErrInvalidQuery = problem.New("invalid_query", http.StatusBadRequest, "invalid query parameters")
+
+	// ErrTimeout is returned to requests running out of time.
+	ErrTimeout = problem.New("timeout", http.StatusGatewayTimeout, "request timed out")
+
+	// ErrUnavailable is returned while the circuit of an upstream is open.
+	ErrUnavailable = problem.New("unavailable", http.StatusServiceUnavailable, "service unavailable")
+
+	// ErrUpstream is returned when an upstream fails unexpectedly.
+	ErrUpstream = problem.New("upstream", http.StatusBadGateway, "upstream service failed")
+
+	// ErrTooManyRequests is returned to clients exceeding their rate limit.
+	ErrTooManyRequests = problem.New("too_many_requests", http.StatusTooManyRequests, "too many requests")
 )
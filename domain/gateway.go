@@ -2,6 +2,9 @@ package domain
 
 import (
 	"context"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -12,7 +15,8 @@ import (
 
 // GatewayListOfBikes lists bikes with pagination.
 func GatewayListOfBikes(ctx context.Context, conf configuration.GatewayConfiguration, cursor string, limit int64) ([]models.Bike, error) {
-	resp, err := httpx.Client().Get(conf.BikeURL + "/bikes/")
+	resp, err := httpx.Get(httpx.Idempotent(ctx), httpx.UpstreamsFromContext(ctx).Bike,
+		conf.BikeURL+"/bikes/")
 	if err != nil {
 		return nil, errors.Wrap(err, "an error occured while connecting bike service")
 	}
@@ -26,9 +30,36 @@ func GatewayListOfBikes(ctx context.Context, conf configuration.GatewayConfigura
 	return bikes, nil
 }
 
+// GatewayListBikesNear lists bikes within radius meters of a location,
+// closest first.
+func GatewayListBikesNear(ctx context.Context, conf configuration.GatewayConfiguration,
+	lat, lng, radius float64, limit int64) ([]models.NearbyBike, error) {
+
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	query.Set("lng", strconv.FormatFloat(lng, 'f', -1, 64))
+	query.Set("radius", strconv.FormatFloat(radius, 'f', -1, 64))
+	query.Set("limit", strconv.FormatInt(limit, 10))
+
+	resp, err := httpx.Get(httpx.Idempotent(ctx), httpx.UpstreamsFromContext(ctx).Bike,
+		conf.BikeURL+"/bikes/near?"+query.Encode())
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while connecting bike service")
+	}
+
+	bikes, err := DeserializeNearbyBikesFromResponse(resp)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while deserializing nearby bikes from http response")
+	}
+
+	return bikes, nil
+}
+
 // GatewayGetBikeByID returns a bike given an valid ID.
 func GatewayGetBikeByID(ctx context.Context, conf configuration.GatewayConfiguration, bikeID string) (*models.Bike, error) {
-	resp, err := httpx.Client().Get(conf.BikeURL + "/bike/" + bikeID)
+	resp, err := httpx.Get(httpx.Idempotent(ctx), httpx.UpstreamsFromContext(ctx).Bike,
+		conf.BikeURL+"/bike/"+bikeID)
 	if err != nil {
 		return nil, errors.Wrap(err, "an error occured while connecting bike service")
 	}
@@ -42,34 +73,67 @@ func GatewayGetBikeByID(ctx context.Context, conf configuration.GatewayConfigura
 	return bike, nil
 }
 
-// GatewayStartTrip unsuprisingly starts a trip when possible.
-func GatewayStartTrip(ctx context.Context, conf configuration.GatewayConfiguration, bikeID string,
-	lat, lng float64) (*models.Trip, error) {
-
-	bike, err := LockBikeFromGateway(ctx, conf, bikeID)
+// GatewayGetTrip returns a trip given an valid ID.
+func GatewayGetTrip(ctx context.Context, conf configuration.GatewayConfiguration, tripID string) (*models.Trip, error) {
+	resp, err := httpx.Get(httpx.Idempotent(ctx), httpx.UpstreamsFromContext(ctx).Trip,
+		conf.TripURL+"/trip/"+url.PathEscape(tripID))
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "an error occured while connecting trip service")
 	}
 
-	trip, err := StartTripFromGateway(ctx, conf, bike.ID, lat, lng)
+	trip, err := DeserializeTripFromResponse(resp)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err,
+			"an error occured while deserializing a trip from http reponse")
 	}
 
 	return trip, nil
 }
 
-// GatewayEndTrip unsuprisingly starts a trip when possible.
-func GatewayEndTrip(ctx context.Context, conf configuration.GatewayConfiguration, tripID string, lat, lng float64) (*models.Trip, error) {
-	trip, err := EndTripFromGateway(ctx, conf, tripID, lat, lng)
+// GatewayListTrips lists the trips of a bike when bikeID is set,
+// or the trips started within [from, to) with one of the given statuses.
+// Only the trips of riderID are listed, unless it is empty.
+func GatewayListTrips(ctx context.Context, conf configuration.GatewayConfiguration, riderID, bikeID string,
+	from, to time.Time, statuses []int, cursor string, limit int64) ([]models.Trip, error) {
+
+	query := url.Values{}
+	if riderID != "" {
+		query.Set("rider_id", riderID)
+	}
+
+	if bikeID != "" {
+		query.Set("bike_id", bikeID)
+	}
+
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+
+	for _, status := range statuses {
+		query.Add("status", strconv.Itoa(status))
+	}
+
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	query.Set("limit", strconv.FormatInt(limit, 10))
+
+	resp, err := httpx.Get(httpx.Idempotent(ctx), httpx.UpstreamsFromContext(ctx).Trip,
+		conf.TripURL+"/trips?"+query.Encode())
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "an error occured while connecting trip service")
 	}
 
-	err = UnLockBikeFromGateway(ctx, conf, trip.BikeID)
+	trips, err := DeserializeTripsFromResponse(resp)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err,
+			"an error occured while deserializing trips from http response")
 	}
 
-	return trip, nil
+	return trips, nil
 }
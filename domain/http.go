@@ -4,13 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/httpx"
 	"github.com/EarvinKayonga/rider/models"
-	"github.com/EarvinKayonga/rider/storage"
+	"github.com/EarvinKayonga/rider/problem"
 )
 
 const (
@@ -19,7 +20,7 @@ const (
 
 // LockBikeFromGateway locks a bike.
 func LockBikeFromGateway(ctx context.Context, conf configuration.GatewayConfiguration, bikeID string) (*models.Bike, error) {
-	resp, err := httpx.Client().Get(conf.BikeURL + "/lock/" + bikeID)
+	resp, err := httpx.Get(ctx, httpx.UpstreamsFromContext(ctx).Bike, conf.BikeURL+"/lock/"+bikeID)
 	if err != nil {
 		return nil, errors.Wrap(err, "an error occured while connecting bike service")
 	}
@@ -33,8 +34,10 @@ func LockBikeFromGateway(ctx context.Context, conf configuration.GatewayConfigur
 }
 
 // UnLockBikeFromGateway unlocks a bike.
+// It is retried, unlocking an available bike being harmless.
 func UnLockBikeFromGateway(ctx context.Context, conf configuration.GatewayConfiguration, bikeID string) error {
-	resp, err := httpx.Client().Get(conf.BikeURL + "/unlock/" + bikeID)
+	resp, err := httpx.Get(httpx.Idempotent(ctx), httpx.UpstreamsFromContext(ctx).Bike,
+		conf.BikeURL+"/unlock/"+bikeID)
 	if err != nil {
 		return errors.Wrap(err, "an error occured while connecting bike service")
 	}
@@ -56,7 +59,7 @@ func DeserializeBikesFromResponse(resp *http.Response) ([]models.Bike, error) {
 		return nil, ErrEmptyBody
 	}
 
-	err := readStatus(resp.StatusCode)
+	err := readStatus(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +73,33 @@ func DeserializeBikesFromResponse(resp *http.Response) ([]models.Bike, error) {
 	return bikes, nil
 }
 
+// DeserializeNearbyBikesFromResponse tries to extract an array of nearby bikes for an http Response.
+func DeserializeNearbyBikesFromResponse(resp *http.Response) ([]models.NearbyBike, error) {
+	if resp != nil {
+		defer func() {
+			thr := resp.Body.Close()
+			_ = thr
+		}()
+	}
+
+	if resp.Body == nil {
+		return nil, ErrEmptyBody
+	}
+
+	err := readStatus(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	bikes := []models.NearbyBike{}
+	err = json.NewDecoder(resp.Body).Decode(&bikes)
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while decoding message from bike service")
+	}
+
+	return bikes, nil
+}
+
 // DeserializeBikeFromResponse tries to extract a bike for an http Response.
 func DeserializeBikeFromResponse(resp *http.Response) (*models.Bike, error) {
 	if resp != nil {
@@ -83,7 +113,7 @@ func DeserializeBikeFromResponse(resp *http.Response) (*models.Bike, error) {
 		return nil, ErrEmptyBody
 	}
 
-	err := readStatus(resp.StatusCode)
+	err := readStatus(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +140,7 @@ func DeserializeTripFromResponse(resp *http.Response) (*models.Trip, error) {
 		return nil, ErrEmptyBody
 	}
 
-	err := readStatus(resp.StatusCode)
+	err := readStatus(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -124,14 +154,43 @@ func DeserializeTripFromResponse(resp *http.Response) (*models.Trip, error) {
 	return &trip, nil
 }
 
+// DeserializeTripsFromResponse tries to extract an array of trips for an http Response.
+func DeserializeTripsFromResponse(resp *http.Response) ([]models.Trip, error) {
+	if resp != nil {
+		defer func() {
+			thr := resp.Body.Close()
+			_ = thr
+		}()
+	}
+
+	if resp.Body == nil {
+		return nil, ErrEmptyBody
+	}
+
+	err := readStatus(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	trips := []models.Trip{}
+	err = json.NewDecoder(resp.Body).Decode(&trips)
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while decoding message from trip service")
+	}
+
+	return trips, nil
+}
+
 // StartTripFromGateway calls the trip service to start a trip.
-func StartTripFromGateway(ctx context.Context, conf configuration.GatewayConfiguration, bikeID string, lat, lng float64) (*models.Trip, error) {
-	body, err := createStartTripBody(bikeID, lat, lng)
+func StartTripFromGateway(ctx context.Context, conf configuration.GatewayConfiguration, bikeID, riderID string,
+	lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+	body, err := createStartTripBody(bikeID, riderID, lat, lng, recordedAt)
 	if err != nil {
 		return nil, errors.Wrap(err, "an error occured while create start trip payload")
 	}
 
-	resp, err := httpx.Client().Post(conf.TripURL+"/trip/start", jsonContentType, body)
+	resp, err := httpx.Post(ctx, httpx.UpstreamsFromContext(ctx).Trip,
+		conf.TripURL+"/trip/start", jsonContentType, body)
 	if err != nil {
 		return nil, errors.Wrap(err, "an error occured while connecting trip service")
 	}
@@ -146,7 +205,7 @@ func StartTripFromGateway(ctx context.Context, conf configuration.GatewayConfigu
 		return nil, ErrEmptyBody
 	}
 
-	err = readStatus(resp.StatusCode)
+	err = readStatus(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -161,13 +220,15 @@ func StartTripFromGateway(ctx context.Context, conf configuration.GatewayConfigu
 }
 
 // EndTripFromGateway calls the trip service to end a trip.
-func EndTripFromGateway(ctx context.Context, conf configuration.GatewayConfiguration, tripID string, lat, lng float64) (*models.Trip, error) {
-	body, err := createEndTripBody(tripID, lat, lng)
+func EndTripFromGateway(ctx context.Context, conf configuration.GatewayConfiguration, tripID string,
+	lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+	body, err := createEndTripBody(tripID, lat, lng, recordedAt)
 	if err != nil {
 		return nil, errors.Wrap(err, "an error occured while create end trip payload")
 	}
 
-	resp, err := httpx.Client().Post(conf.TripURL+"/trip/end", jsonContentType, body)
+	resp, err := httpx.Post(ctx, httpx.UpstreamsFromContext(ctx).Trip,
+		conf.TripURL+"/trip/end", jsonContentType, body)
 	if err != nil {
 		return nil, errors.Wrap(err, "an error occured while connecting trip service")
 	}
@@ -182,7 +243,7 @@ func EndTripFromGateway(ctx context.Context, conf configuration.GatewayConfigura
 		return nil, ErrEmptyBody
 	}
 
-	err = readStatus(resp.StatusCode)
+	err = readStatus(resp)
 	if err != nil {
 		return nil, err
 	}
@@ -196,11 +257,23 @@ func EndTripFromGateway(ctx context.Context, conf configuration.GatewayConfigura
 	return &trip, nil
 }
 
-func readStatus(statusCode int) error {
-	switch statusCode {
-	case http.StatusNotFound:
-		return storage.ErrBikeNotFound
-	default:
+// readStatus converts an error response of a service
+// back to the error it was raised from.
+func readStatus(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
 		return nil
 	}
+
+	if resp.StatusCode == http.StatusGatewayTimeout {
+		return context.DeadlineExceeded
+	}
+
+	// the failures of a service are failures
+	// of an upstream to the caller.
+	err := problem.Read(resp)
+	if err.Status >= http.StatusInternalServerError {
+		return ErrUpstream.WithDetail(err.Error())
+	}
+
+	return err
 }
@@ -3,49 +3,51 @@ package domain
 import (
 	"context"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
-	bus "github.com/rafaeljesus/nsq-event-bus"
 
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/logging"
 	"github.com/EarvinKayonga/rider/messaging"
 	"github.com/EarvinKayonga/rider/storage"
+	"github.com/EarvinKayonga/rider/tracing"
 )
 
 // ListenerToBikeEvent for bike events.
+// Locations are written by batches.
 func ListenerToBikeEvent(ctx context.Context, conf configuration.BikeConfiguration,
 	logger logging.Logger, database storage.BikeStore) (messaging.Consumer, error) {
 
-	listener, err := messaging.NewConsumer(ctx, conf.Messaging.Consumption, logger,
-		func(message *bus.Message) (interface{}, error) {
-			defer message.Finish()
-
-			m := TrackTripPayload{}
-
-			err := message.DecodePayload(&m)
-			if err != nil {
-				logger.
-					WithError(err).
-					Error("an error occured while decoding bike event payload")
-
-				return nil, errors.Wrap(err,
-					"an error occured while decoding bike event payload")
-			}
-
-			err = database.UpdateBikeLocation(ctx, m.BikeID, m.Lat, m.Lng)
-			if err != nil {
-				logger.
-					WithError(err).
-					Error("an error occured while updating bike location")
-
-				return nil, errors.Wrap(err,
-					"an error occured while updating bike location")
-			}
-
-			logger.Info("bike location successfully updated")
-
-			return nil, nil
-		})
+	listener, err := messaging.NewBatchConsumer(ctx, conf.Messaging.Consumption, logger,
+		messaging.Dispatch(logger, map[messaging.EventType]messaging.EventHandler{
+			messaging.TripLocationTracked: func(ctx context.Context, events []messaging.Event) error {
+				payloads := decodeTrackPayloads(ctx, events, logger)
+				logger := logger.WithField("request_ids", requestIDs(events))
+
+				bikes := []storage.Bike{}
+				for _, m := range payloads {
+					bikes = append(bikes, storage.Bike{
+						PublicID:  m.BikeID,
+						Latitude:  m.Lat,
+						Longitude: m.Lng,
+					})
+				}
+
+				err := database.UpdateBikeLocations(ctx, bikes)
+				if err != nil {
+					logger.
+						WithError(err).
+						Error("an error occured while updating bike locations")
+
+					return errors.Wrap(err,
+						"an error occured while updating bike locations")
+				}
+
+				logger.Infof("%d bike locations successfully updated", len(bikes))
+
+				return nil
+			},
+		}))
 
 	if err != nil {
 		return nil, errors.Wrap(err,
@@ -58,46 +60,102 @@ func ListenerToBikeEvent(ctx context.Context, conf configuration.BikeConfigurati
 }
 
 // ListenerToTripEvent for trip events.
+// Locations are written by batches.
 func ListenerToTripEvent(ctx context.Context, conf configuration.TripConfiguration,
 	logger logging.Logger, database storage.TripStore) (messaging.Consumer, error) {
 
-	listener, err := messaging.NewConsumer(ctx, conf.Messaging.Consumption, logger,
-		func(message *bus.Message) (interface{}, error) {
-			defer message.Finish()
+	listener, err := messaging.NewBatchConsumer(ctx, conf.Messaging.Consumption, logger,
+		messaging.Dispatch(logger, map[messaging.EventType]messaging.EventHandler{
+			messaging.TripLocationTracked: func(ctx context.Context, events []messaging.Event) error {
+				payloads := decodeTrackPayloads(ctx, events, logger)
+				logger := logger.WithField("request_ids", requestIDs(events))
+
+				locations := []storage.Location{}
+				for _, m := range payloads {
+					locations = append(locations, storage.Location{
+						TripID:    m.TripID,
+						Latitude:  m.Lat,
+						Longitude: m.Lng,
+						RecordedAt: pq.NullTime{
+							Time:  deviceTime(m.RecordedAt),
+							Valid: m.RecordedAt != nil,
+						},
+					})
+				}
+
+				err := database.AddLocationsToTrips(ctx, locations)
+				if err != nil {
+					logger.
+						WithError(err).
+						Error("an error occured while updating trips with locations")
+
+					return errors.Wrap(err,
+						"an error occured while updating trips with locations")
+				}
+
+				logger.Infof("%d trip locations successfully added", len(locations))
+
+				return nil
+			},
+		}))
+
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while creating a consumer")
+	}
+
+	logger.Info("trip event consumer created")
 
-			m := TrackTripPayload{}
+	return listener, nil
+}
 
-			err := message.DecodePayload(&m)
-			if err != nil {
-				logger.
-					WithError(err).
-					Error("an error occured while decoding trip event payload")
+// decodeTrackPayloads decodes a batch of track events,
+// linking the span of the batch to the traces of the events.
+// Undecodable payloads are sent to the dead letter topic,
+// requeuing them would not make them valid.
+func decodeTrackPayloads(ctx context.Context, events []messaging.Event, logger logging.Logger) []TrackTripPayload {
+	span := tracing.SpanFromContext(ctx)
+	payloads := make([]TrackTripPayload, 0, len(events))
+	for _, event := range events {
+		m := TrackTripPayload{}
 
-				return nil, errors.Wrap(err,
-					"an error occured while decoding trip event payload")
-			}
+		err := event.Decode(&m)
+		if err != nil {
+			logger.
+				WithError(err).
+				Error("an error occured while decoding track event payload")
 
-			err = database.AddLocationToTrip(ctx, m.TripID, m.Lat, m.Lng)
-			if err != nil {
-				logger.
-					WithError(err).
-					Error("an error occured while updating trip with a location")
+			event.Message.Reject(errors.Wrap(err,
+				"an error occured while decoding track event payload"))
 
-				return nil, errors.Wrap(err,
-					"an error occured while updating a trip with a location")
-			}
+			continue
+		}
 
-			logger.Info("trip location successfully updated")
+		if parent, ok := tracing.ParseSpanContext(event.Trace); ok {
+			span.AddLink(parent)
+		}
 
-			return nil, nil
-		})
+		logger.WithRequestID(event.CorrelationID).
+			Debugf("received location of bike %s, trip %s", m.BikeID, m.TripID)
 
-	if err != nil {
-		return nil, errors.Wrap(err,
-			"an error occured while creating a consumer")
+		payloads = append(payloads, m)
 	}
 
-	logger.Info("trip event consumer created")
+	return payloads
+}
 
-	return listener, nil
+// requestIDs returns the distinct request ids of a batch.
+func requestIDs(events []messaging.Event) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, event := range events {
+		if event.CorrelationID == "" || seen[event.CorrelationID] {
+			continue
+		}
+
+		seen[event.CorrelationID] = true
+		ids = append(ids, event.CorrelationID)
+	}
+
+	return ids
 }
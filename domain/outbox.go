@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/messaging"
+	"github.com/EarvinKayonga/rider/storage"
+	"github.com/EarvinKayonga/rider/tracing"
+)
+
+// outboxSweepInterval is the period of the deletion of the sent events.
+const outboxSweepInterval = time.Hour
+
+// OutboxRelay publishes the events of the outbox of a service,
+// marking them sent once the broker has them. An event is sent again
+// when the relay stops in between, consumers may receive it twice.
+type OutboxRelay struct {
+	conf     configuration.Outbox
+	database storage.OutboxStore
+	emitter  messaging.Emitter
+	logger   logging.Logger
+}
+
+// NewOutboxRelay returns a valid OutboxRelay.
+func NewOutboxRelay(conf configuration.Outbox, database storage.OutboxStore,
+	emitter messaging.Emitter, logger logging.Logger) *OutboxRelay {
+
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = configuration.DefaultOutbox.PollInterval
+	}
+
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = configuration.DefaultOutbox.BatchSize
+	}
+
+	if conf.Retention <= 0 {
+		conf.Retention = configuration.DefaultOutbox.Retention
+	}
+
+	return &OutboxRelay{
+		conf:     conf,
+		database: database,
+		emitter:  emitter,
+		logger:   logger,
+	}
+}
+
+// Run relays the outbox every PollInterval until ctx is done,
+// deleting every outboxSweepInterval the events sent Retention ago.
+func (e *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.conf.PollInterval)
+	defer ticker.Stop()
+
+	sweeper := time.NewTicker(outboxSweepInterval)
+	defer sweeper.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Relay(ctx)
+		case <-sweeper.C:
+			e.Sweep(ctx)
+		case <-ctx.Done():
+			e.logger.Info("outbox relay is shut down")
+			return nil
+		}
+	}
+}
+
+// Relay publishes the pending events in order, batch after batch,
+// stopping at the first one the broker does not take.
+func (e *OutboxRelay) Relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		failed, relayed := false, 0
+		listed, err := e.database.RelayEvents(ctx, e.conf.BatchSize, func(events []messaging.Envelope) []string {
+			sent := []string{}
+			for _, event := range events {
+				err := e.emitter.EmitEnvelope(e.eventContext(ctx, event), event)
+				if err != nil {
+					e.logger.
+						WithRequestID(event.CorrelationID).
+						WithError(err).
+						Warnf("an error occured while relaying %s event %s", event.Type, event.ID)
+
+					failed = true
+					break
+				}
+
+				sent = append(sent, event.ID)
+			}
+
+			relayed = len(sent)
+			return sent
+		})
+		if err != nil {
+			e.logger.WithError(err).Error("an error occured while relaying events")
+			return
+		}
+
+		if relayed > 0 {
+			e.logger.Infof("%d events relayed", relayed)
+		}
+
+		if failed || int64(listed) < e.conf.BatchSize {
+			return
+		}
+	}
+}
+
+// Sweep deletes the events sent Retention ago.
+func (e *OutboxRelay) Sweep(ctx context.Context) {
+	deleted, err := e.database.DeleteSentEvents(ctx, time.Now().Add(-e.conf.Retention))
+	if err != nil {
+		e.logger.WithError(err).Error("an error occured while deleting sent events")
+		return
+	}
+
+	if deleted > 0 {
+		e.logger.Infof("%d sent events deleted", deleted)
+	}
+}
+
+// eventContext returns the context of the request which wrote event,
+// so that its emission is correlated with it.
+func (e *OutboxRelay) eventContext(ctx context.Context, event messaging.Envelope) context.Context {
+	ctx = logging.NewRequestIDContext(ctx, event.CorrelationID)
+	return tracing.Extract(ctx, event.Trace)
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/storage"
+)
+
+// DefaultTripRidersSize bounds the trips whose rider is remembered.
+const DefaultTripRidersSize = 10000
+
+// TripRiders tells whether riders may act on trips,
+// remembering the rider and bike of the trips it fetched:
+// they never change.
+type TripRiders struct {
+	mutex sync.Mutex
+	trips map[string]tripRider
+	order []string
+	next  int
+}
+
+type tripRider struct {
+	riderID string
+	bikeID  string
+}
+
+// NewTripRiders returns a TripRiders remembering up to size trips.
+func NewTripRiders(size int) *TripRiders {
+	if size <= 0 {
+		size = DefaultTripRidersSize
+	}
+
+	return &TripRiders{
+		trips: make(map[string]tripRider, size),
+		order: make([]string, size),
+	}
+}
+
+// Authorize checks that a trip was started by riderID, returning its bike.
+// Trips started before riders were authenticated belong to nobody.
+func (e *TripRiders) Authorize(ctx context.Context, conf configuration.GatewayConfiguration,
+	tripID, riderID string) (string, error) {
+
+	owner, ok := e.get(tripID)
+	if !ok {
+		trip, err := GatewayGetTrip(ctx, conf, tripID)
+		if err != nil {
+			return "", err
+		}
+
+		owner = tripRider{
+			riderID: trip.RiderID,
+			bikeID:  trip.BikeID,
+		}
+
+		e.add(tripID, owner)
+	}
+
+	// the trip of another rider is not found, so that its existence is not revealed.
+	if owner.riderID == "" || owner.riderID != riderID {
+		return "", storage.ErrTripNotFound
+	}
+
+	return owner.bikeID, nil
+}
+
+func (e *TripRiders) get(tripID string) (tripRider, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	owner, ok := e.trips[tripID]
+	return owner, ok
+}
+
+// add remembers a trip, forgetting the oldest one when full.
+func (e *TripRiders) add(tripID string, owner tripRider) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.trips[tripID]; ok {
+		return
+	}
+
+	delete(e.trips, e.order[e.next])
+	e.order[e.next] = tripID
+	e.next = (e.next + 1) % len(e.order)
+
+	e.trips[tripID] = owner
+}
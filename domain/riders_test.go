@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/httpx"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/stats"
+	"github.com/EarvinKayonga/rider/storage"
+)
+
+func TestAuthorize(t *testing.T) {
+	riders := NewTripRiders(10)
+	riders.add("trip-1", tripRider{riderID: "rider-1", bikeID: "bike-1"})
+	riders.add("trip-legacy", tripRider{bikeID: "bike-2"})
+
+	// unknown trips are fetched from the trip service.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"type":"urn:rider:error:trip_not_found","title":"trip not found","status":404,"code":"trip_not_found"}`))
+	}))
+	defer server.Close()
+
+	conf := configuration.GatewayConfiguration{TripURL: server.URL}
+	upstreams, err := httpx.NewUpstreams(conf,
+		*logging.NewLogger(configuration.Logging{Level: "error"}), stats.Mock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := httpx.NewContext(context.Background(), upstreams)
+
+	tests := []struct {
+		name    string
+		tripID  string
+		riderID string
+		bikeID  string
+		err     error
+	}{
+		{name: "own trip", tripID: "trip-1", riderID: "rider-1", bikeID: "bike-1"},
+		{name: "trip of another rider", tripID: "trip-1", riderID: "rider-2", err: storage.ErrTripNotFound},
+		{name: "trip without rider", tripID: "trip-legacy", riderID: "rider-1", err: storage.ErrTripNotFound},
+		{name: "unknown trip", tripID: "trip-unknown", riderID: "rider-1", err: storage.ErrTripNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bikeID, err := riders.Authorize(ctx, conf, test.tripID, test.riderID)
+			if test.err == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if bikeID != test.bikeID {
+					t.Fatalf("expected bike %s, got %s", test.bikeID, bikeID)
+				}
+
+				return
+			}
+
+			if errors.Cause(err) != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
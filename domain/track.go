@@ -2,8 +2,10 @@ package domain
 
 import (
 	"context"
+	"time"
 
 	"github.com/EarvinKayonga/rider/messaging"
+	"github.com/EarvinKayonga/rider/validation"
 )
 
 // TrackTripPayload for messaging.
@@ -11,11 +13,27 @@ type TrackTripPayload struct {
 	Lng, Lat float64
 	BikeID   string
 	TripID   string
+
+	// RecordedAt is the optional device time of the location.
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+}
+
+// Validate checks the payload received by the gateway,
+// the bike being optional.
+func (e TrackTripPayload) Validate() error {
+	v := validation.Fields()
+	v.ID("TripID", e.TripID, true)
+	v.Identifier("BikeID", e.BikeID, false, IsValidBikeID)
+	v.Latitude("Lat", e.Lat)
+	v.Longitude("Lng", e.Lng)
+
+	return v.Err()
 }
 
-// TrackTrip sends a payload through the messaging pipeline.
+// TrackTrip sends a payload through the messaging pipeline,
+// as the payload of a messaging.TripLocationTracked event.
 func TrackTrip(ctx context.Context,
 	messenger messaging.Emitter, hearbeat TrackTripPayload) error {
 
-	return messenger.Emit(ctx, &hearbeat)
+	return messenger.Emit(ctx, messaging.TripLocationTracked, hearbeat)
 }
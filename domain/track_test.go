@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/entropy"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/messaging"
+	"github.com/EarvinKayonga/rider/stats"
+	"github.com/EarvinKayonga/rider/storage"
+)
+
+// TestTrackTrip sends tracked locations through the in-memory bus
+// to the consumers of the bike and trip services.
+func TestTrackTrip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctx = entropy.NewContext(ctx, entropy.NewIDGenerator())
+
+	logger := *logging.NewLogger(configuration.Logging{Level: "error"})
+	consumption := configuration.Consumption{
+		Driver:        configuration.MemoryDriver,
+		Topic:         "test_track_trip",
+		BatchSize:     10,
+		BatchInterval: 10 * time.Millisecond,
+	}
+
+	bikes, err := storage.NewMemoryDatabase(ctx, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trips, err := storage.NewMemoryDatabase(ctx, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = bikes.CreateBikes(ctx, []storage.Bike{{PublicID: "bike-1", Latitude: 48.85, Longitude: 2.35}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trip, err := trips.CreateTrip(ctx, "bike-1", "rider-1", 48.85, 2.35, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bikeConf := configuration.BikeConfiguration{}
+	bikeConf.Messaging.Consumption = consumption
+	bikeConf.Messaging.Consumption.Channel = "bike"
+
+	tripConf := configuration.TripConfiguration{}
+	tripConf.Messaging.Consumption = consumption
+	tripConf.Messaging.Consumption.Channel = "trip"
+
+	bikeListener, err := ListenerToBikeEvent(ctx, bikeConf, logger, bikes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tripListener, err := ListenerToTripEvent(ctx, tripConf, logger, trips)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, listener := range []messaging.Consumer{bikeListener, tripListener} {
+		go func(listener messaging.Consumer) {
+			_ = listener.Run(ctx)
+		}(listener)
+	}
+
+	emitter, err := messaging.NewEmitter(ctx, "gateway", configuration.Emission{
+		Driver: configuration.MemoryDriver,
+		Topic:  consumption.Topic,
+	}, logger, stats.Mock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// channels only receive the messages published once they are subscribed,
+	// a first location is tracked until both services have it.
+	track := func(lat, lng float64) {
+		err := TrackTrip(ctx, emitter, TrackTripPayload{
+			Lat:    lat,
+			Lng:    lng,
+			BikeID: "bike-1",
+			TripID: trip.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tracked := func(lat, lng float64) bool {
+		bike, err := bikes.FindBikeByPublicID(ctx, "bike-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		locations, err := trips.GetLocationsForTrip(ctx, trip.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		last := locations[len(locations)-1].Coordinates
+		return reflect.DeepEqual(bike.Location.Coordinates, []float64{lat, lng}) &&
+			reflect.DeepEqual(last, []float64{lat, lng})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !tracked(48.86, 2.36) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the first location to reach the bike and trip services")
+		}
+
+		track(48.86, 2.36)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	track(48.87, 2.37)
+	for !tracked(48.87, 2.37) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the last location to reach the bike and trip services")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
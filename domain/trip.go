@@ -2,18 +2,43 @@ package domain
 
 import (
 	"context"
+	"time"
 
 	"github.com/EarvinKayonga/rider/models"
 	"github.com/EarvinKayonga/rider/storage"
 )
 
-// StartTrip unsuprisingly starts a trip when possible.
-func StartTrip(ctx context.Context, bikeID string,
-	lat, lng float64) (*models.Trip, error) {
-	return storage.TripStoreFromContext(ctx).CreateTrip(ctx, bikeID, lat, lng)
+// StartTrip unsuprisingly starts a trip when possible,
+// for the given rider.
+func StartTrip(ctx context.Context, bikeID, riderID string,
+	lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+	trip, err := storage.TripStoreFromContext(ctx).CreateTrip(ctx, bikeID, riderID, lat, lng, deviceTime(recordedAt))
+	if err == storage.ErrActiveTrip {
+		return nil, ErrBikeInUse
+	}
+
+	return trip, err
 }
 
 // EndTrip unsuprisingly starts a trip when possible.
-func EndTrip(ctx context.Context, tripID string, lat, lng float64) (*models.Trip, error) {
-	return storage.TripStoreFromContext(ctx).EndTrip(ctx, tripID, lat, lng)
+func EndTrip(ctx context.Context, tripID string, lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+	return storage.TripStoreFromContext(ctx).EndTrip(ctx, tripID, lat, lng, deviceTime(recordedAt))
+}
+
+// GetTrip returns a trip along with its locations.
+func GetTrip(ctx context.Context, tripID string) (*models.Trip, error) {
+	return storage.TripStoreFromContext(ctx).GetTrip(ctx, tripID)
+}
+
+// ListTripsForBike lists the trips of a bike, newest first,
+// only the ones of riderID unless it is empty.
+func ListTripsForBike(ctx context.Context, bikeID, riderID string, cursor string, limit int64) ([]models.Trip, error) {
+	return storage.TripStoreFromContext(ctx).ListTripsForBike(ctx, bikeID, riderID, cursor, limit)
+}
+
+// ListTrips lists the trips started within [from, to)
+// with one of the given statuses, newest first,
+// only the ones of riderID unless it is empty.
+func ListTrips(ctx context.Context, riderID string, from, to time.Time, statuses []int, cursor string, limit int64) ([]models.Trip, error) {
+	return storage.TripStoreFromContext(ctx).ListTrips(ctx, riderID, from, to, statuses, cursor, limit)
 }
@@ -4,37 +4,82 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/models"
+	"github.com/EarvinKayonga/rider/validation"
 )
 
 // EndTripPayload specifies the expected http body
 // for ending a trip.
 type EndTripPayload struct {
-	TripID   string   `json:"trip_id"`
-	Location Location `json:"location"`
+	TripID     string     `json:"trip_id"`
+	Location   Location   `json:"location"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
 }
 
 // StartTripPayload specifies the expected http body
 // for starting a trip.
 type StartTripPayload struct {
-	BikeID   string   `json:"bike_id"`
-	Location Location `json:"location"`
+	BikeID     string     `json:"bike_id"`
+	RiderID    string     `json:"rider_id,omitempty"`
+	Location   Location   `json:"location"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+}
+
+// BikeStatusPayload specifies the expected http body
+// for changing the status of a bike. Status is required,
+// its zero value being in_use.
+type BikeStatusPayload struct {
+	Status *models.BikeStatus `json:"status"`
+}
+
+// Validate checks the status is set.
+func (e BikeStatusPayload) Validate() error {
+	v := validation.Fields()
+	v.Check(e.Status != nil, "status", "is required")
+
+	return v.Err()
 }
 
 // Location specifies location model.
+// Its coordinates are pointers, so that missing ones
+// are told apart from the 0,0 location.
 type Location struct {
-	Lat float64 `json:"lat"`
-	Lng float64 `json:"lng"`
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
+}
+
+// NewLocation returns the location at lat, lng.
+func NewLocation(lat, lng float64) Location {
+	return Location{
+		Lat: &lat,
+		Lng: &lng,
+	}
+}
+
+// Point returns the coordinates of the location,
+// zero when missing.
+func (e Location) Point() (lat, lng float64) {
+	if e.Lat != nil {
+		lat = *e.Lat
+	}
+
+	if e.Lng != nil {
+		lng = *e.Lng
+	}
+
+	return lat, lng
 }
 
-func createStartTripBody(bikeID string, lat, lng float64) (io.Reader, error) {
+func createStartTripBody(bikeID, riderID string, lat, lng float64, recordedAt *time.Time) (io.Reader, error) {
 	start := StartTripPayload{
-		BikeID: bikeID,
-		Location: Location{
-			Lat: lat,
-			Lng: lng,
-		},
+		BikeID:     bikeID,
+		RiderID:    riderID,
+		Location:   NewLocation(lat, lng),
+		RecordedAt: recordedAt,
 	}
 
 	jsonValue, err := json.Marshal(start)
@@ -46,13 +91,11 @@ func createStartTripBody(bikeID string, lat, lng float64) (io.Reader, error) {
 	return bytes.NewBuffer(jsonValue), nil
 }
 
-func createEndTripBody(tripID string, lat, lng float64) (io.Reader, error) {
+func createEndTripBody(tripID string, lat, lng float64, recordedAt *time.Time) (io.Reader, error) {
 	end := EndTripPayload{
-		TripID: tripID,
-		Location: Location{
-			Lat: lat,
-			Lng: lng,
-		},
+		TripID:     tripID,
+		Location:   NewLocation(lat, lng),
+		RecordedAt: recordedAt,
 	}
 
 	jsonValue, err := json.Marshal(end)
@@ -63,3 +106,43 @@ func createEndTripBody(tripID string, lat, lng float64) (io.Reader, error) {
 
 	return bytes.NewBuffer(jsonValue), nil
 }
+
+// deviceTime returns the time a device recorded a location at,
+// zero when it did not tell.
+func deviceTime(recordedAt *time.Time) time.Time {
+	if recordedAt == nil {
+		return time.Time{}
+	}
+
+	return *recordedAt
+}
+
+// validate checks the location as a field of a payload.
+func (e Location) validate(v *validation.Validator, field string) {
+	v.Check(e.Lat != nil, field+".lat", "is required")
+	v.Check(e.Lng != nil, field+".lng", "is required")
+
+	lat, lng := e.Point()
+	v.Latitude(field+".lat", lat)
+	v.Longitude(field+".lng", lng)
+}
+
+// Validate checks the payload received by the gateway,
+// the rider being the one authenticated.
+func (e StartTripPayload) Validate() error {
+	v := validation.Fields()
+	v.Identifier("bike_id", e.BikeID, true, IsValidBikeID)
+	v.Check(e.RiderID == "", "rider_id", "is set by the gateway")
+	e.Location.validate(v, "location")
+
+	return v.Err()
+}
+
+// Validate checks the payload received by the gateway.
+func (e EndTripPayload) Validate() error {
+	v := validation.Fields()
+	v.ID("trip_id", e.TripID, true)
+	e.Location.validate(v, "location")
+
+	return v.Err()
+}
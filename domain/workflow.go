@@ -0,0 +1,443 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/httpx"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/models"
+	"github.com/EarvinKayonga/rider/problem"
+	"github.com/EarvinKayonga/rider/storage"
+	"github.com/EarvinKayonga/rider/tracing"
+)
+
+// Kinds of the trip workflows.
+const (
+	startTripWorkflow = "start_trip"
+	endTripWorkflow   = "end_trip"
+)
+
+// Steps of the trip workflows.
+// A workflow is logged before each remote call,
+// so that a crash leaves the step it was in.
+const (
+	stepLocking    = "locking"
+	stepBikeLocked = "bike_locked"
+	stepEnding     = "ending"
+	stepTripEnded  = "trip_ended"
+)
+
+// unlockAttempts bounds the unlocks tried after ending a trip,
+// before leaving it to the recovery loop.
+const unlockAttempts = 3
+
+// GatewayStartTrip locks a bike then starts a trip with it.
+// When the trip cannot be started, the bike is unlocked.
+func GatewayStartTrip(ctx context.Context, conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, logger logging.Logger, bikeID, riderID string,
+	lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+
+	ctx, span := tracing.StartSpan(ctx, "start trip workflow", tracing.SpanKindInternal)
+	defer span.End()
+
+	span.SetAttribute("bike_id", bikeID)
+
+	trip, err := runStartTrip(ctx, conf, workflows, logger, bikeID, riderID, lat, lng, recordedAt)
+	span.SetError(err)
+
+	return trip, err
+}
+
+func runStartTrip(ctx context.Context, conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, logger logging.Logger, bikeID, riderID string,
+	lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+
+	workflow := &storage.Workflow{
+		Kind:       startTripWorkflow,
+		Step:       stepLocking,
+		BikeID:     bikeID,
+		Latitude:   lat,
+		Longitude:  lng,
+		RecordedAt: recordedAt,
+		RequestID:  logging.RequestIDFromContext(ctx),
+		Trace:      tracing.MapCarrier{},
+	}
+
+	tracing.Inject(ctx, workflow.Trace)
+
+	err := workflows.SaveWorkflow(ctx, workflow)
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while logging start trip workflow")
+	}
+
+	bike, err := LockBikeFromGateway(ctx, conf, bikeID)
+	if err != nil {
+		if isDefinitive(err) {
+			forgetWorkflow(ctx, workflows, workflow, logger)
+			return nil, err
+		}
+
+		// the bike may have been locked.
+		thr := compensate(ctx, conf, func(ctx context.Context) error {
+			return rollbackStartTrip(ctx, conf, workflows, workflow, logger)
+		})
+		if thr != nil {
+			logger.WithError(thr).Warn("start trip workflow left to recovery")
+		}
+
+		return nil, err
+	}
+
+	// the lock is logged before going on, as only
+	// a workflow known to hold it unlocks the bike.
+	workflow.Step = stepBikeLocked
+	err = workflows.SaveWorkflow(ctx, workflow)
+	if err != nil {
+		thr := compensate(ctx, conf, func(ctx context.Context) error {
+			return rollbackStartTrip(ctx, conf, workflows, workflow, logger)
+		})
+		if thr != nil {
+			logger.WithError(thr).Warn("start trip workflow left to recovery")
+		}
+
+		return nil, errors.Wrap(err, "an error occured while logging start trip workflow")
+	}
+
+	trip, err := StartTripFromGateway(ctx, conf, bike.ID, riderID, lat, lng, recordedAt)
+	if err != nil {
+		thr := compensate(ctx, conf, func(ctx context.Context) error {
+			return rollbackStartTrip(ctx, conf, workflows, workflow, logger)
+		})
+		if thr != nil {
+			logger.WithError(thr).Warn("start trip workflow left to recovery")
+		}
+
+		return nil, err
+	}
+
+	forgetWorkflow(ctx, workflows, workflow, logger)
+
+	return trip, nil
+}
+
+// GatewayEndTrip ends a trip then unlocks its bike.
+// The trip is returned once ended, even though its bike
+// could not be unlocked yet: the recovery loop keeps trying.
+func GatewayEndTrip(ctx context.Context, conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, logger logging.Logger, tripID string,
+	lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+
+	ctx, span := tracing.StartSpan(ctx, "end trip workflow", tracing.SpanKindInternal)
+	defer span.End()
+
+	span.SetAttribute("trip_id", tripID)
+
+	trip, err := runEndTrip(ctx, conf, workflows, logger, tripID, lat, lng, recordedAt)
+	span.SetError(err)
+
+	return trip, err
+}
+
+func runEndTrip(ctx context.Context, conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, logger logging.Logger, tripID string,
+	lat, lng float64, recordedAt *time.Time) (*models.Trip, error) {
+
+	workflow := &storage.Workflow{
+		Kind:       endTripWorkflow,
+		Step:       stepEnding,
+		TripID:     tripID,
+		Latitude:   lat,
+		Longitude:  lng,
+		RecordedAt: recordedAt,
+		RequestID:  logging.RequestIDFromContext(ctx),
+		Trace:      tracing.MapCarrier{},
+	}
+
+	tracing.Inject(ctx, workflow.Trace)
+
+	err := workflows.SaveWorkflow(ctx, workflow)
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while logging end trip workflow")
+	}
+
+	trip, err := EndTripFromGateway(ctx, conf, tripID, lat, lng, recordedAt)
+	if err != nil {
+		if isDefinitive(err) {
+			forgetWorkflow(ctx, workflows, workflow, logger)
+		}
+
+		// otherwise the trip may have been ended,
+		// the recovery loop finds out.
+		return nil, err
+	}
+
+	err = compensate(ctx, conf, func(ctx context.Context) error {
+		return completeEndTrip(ctx, conf, workflows, workflow, trip.BikeID)
+	})
+	if err != nil {
+		logger.WithError(err).Warn("end trip workflow left to recovery")
+	}
+
+	return trip, nil
+}
+
+// compensate runs the compensation of a workflow on a context keeping
+// the values of ctx, such as its request id, trace and upstreams, but not
+// its cancellation: a request given up by its client is still rolled back,
+// within a CompensationTimeout of its own.
+func compensate(ctx context.Context, conf configuration.GatewayConfiguration,
+	compensation func(ctx context.Context) error) error {
+
+	timeout := conf.Workflows.CompensationTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(detached{ctx}, timeout)
+	defer cancel()
+
+	return compensation(ctx)
+}
+
+// detached keeps the values of a context,
+// without its deadline and cancellation.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// rollbackStartTrip unlocks the bike of a start trip workflow,
+// unless a trip did start with it. A bike whose lock got no answer
+// is only unlocked when found in use.
+func rollbackStartTrip(ctx context.Context, conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, workflow *storage.Workflow, logger logging.Logger) error {
+
+	if workflow.Step != stepBikeLocked {
+		bike, err := GatewayGetBikeByID(ctx, conf, workflow.BikeID)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while fetching bike")
+		}
+
+		if bike.Status != models.BikeInUse {
+			return workflows.DeleteWorkflow(ctx, workflow.ID)
+		}
+
+		logger.Warnf("bike %s found in use after a lock without answer", workflow.BikeID)
+	}
+
+	trips, err := GatewayListTrips(ctx, conf, "", workflow.BikeID,
+		time.Time{}, time.Time{}, []int{}, "", 1)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while looking for an active trip")
+	}
+
+	if len(trips) == 0 || trips[0].Status != 1 {
+		err = unlockBike(ctx, conf, workflow.BikeID)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while unlocking bike")
+		}
+	}
+
+	return workflows.DeleteWorkflow(ctx, workflow.ID)
+}
+
+// resumeEndTrip ends the trip of an end trip workflow
+// when it is still active, then unlocks its bike.
+func resumeEndTrip(ctx context.Context, conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, workflow *storage.Workflow) error {
+
+	if workflow.Step == stepTripEnded {
+		return completeEndTrip(ctx, conf, workflows, workflow, workflow.BikeID)
+	}
+
+	trip, err := GatewayGetTrip(ctx, conf, workflow.TripID)
+	if errors.Cause(err) == storage.ErrTripNotFound {
+		return workflows.DeleteWorkflow(ctx, workflow.ID)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "an error occured while fetching trip")
+	}
+
+	if trip.Status == 1 {
+		trip, err = EndTripFromGateway(ctx, conf, workflow.TripID,
+			workflow.Latitude, workflow.Longitude, workflow.RecordedAt)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while ending trip")
+		}
+	}
+
+	return completeEndTrip(ctx, conf, workflows, workflow, trip.BikeID)
+}
+
+// completeEndTrip unlocks the bike of an ended trip.
+func completeEndTrip(ctx context.Context, conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, workflow *storage.Workflow, bikeID string) error {
+
+	if workflow.Step != stepTripEnded {
+		workflow.Step = stepTripEnded
+		workflow.BikeID = bikeID
+
+		err := workflows.SaveWorkflow(ctx, workflow)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while logging end trip workflow")
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt < unlockAttempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(time.Duration(attempt) * 100 * time.Millisecond)
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return errors.Wrap(ctx.Err(), "an error occured while unlocking bike")
+			}
+		}
+
+		err = unlockBike(ctx, conf, workflow.BikeID)
+		if err == nil {
+			return workflows.DeleteWorkflow(ctx, workflow.ID)
+		}
+	}
+
+	return errors.Wrap(err, "an error occured while unlocking bike")
+}
+
+// unlockBike unlocks a bike, an already available bike
+// being a success.
+func unlockBike(ctx context.Context, conf configuration.GatewayConfiguration, bikeID string) error {
+	err := UnLockBikeFromGateway(ctx, conf, bikeID)
+	if errors.Cause(err) == storage.ErrIllegalTransition {
+		return nil
+	}
+
+	return err
+}
+
+// isDefinitive tells whether an error was answered by a service as a problem
+// of the request, or by an open circuit breaker, so that the call is known
+// to have had no effect.
+func isDefinitive(err error) bool {
+	if _, open := httpx.IsCircuitOpen(err); open {
+		return true
+	}
+
+	known, ok := errors.Cause(err).(*problem.Error)
+	return ok && known.Status < http.StatusInternalServerError
+}
+
+func forgetWorkflow(ctx context.Context, workflows storage.WorkflowLog,
+	workflow *storage.Workflow, logger logging.Logger) {
+
+	err := workflows.DeleteWorkflow(ctx, workflow.ID)
+	if err != nil {
+		logger.WithError(err).Warn("an error occured while deleting workflow")
+	}
+}
+
+// WorkflowRecoverer completes or rolls back the trip workflows
+// interrupted by a crash or a failing service.
+type WorkflowRecoverer struct {
+	conf      configuration.GatewayConfiguration
+	workflows storage.WorkflowLog
+	logger    logging.Logger
+}
+
+// NewWorkflowRecoverer returns a valid WorkflowRecoverer.
+func NewWorkflowRecoverer(conf configuration.GatewayConfiguration,
+	workflows storage.WorkflowLog, logger logging.Logger) *WorkflowRecoverer {
+
+	return &WorkflowRecoverer{
+		conf:      conf,
+		workflows: workflows,
+		logger:    logger,
+	}
+}
+
+// Run recovers workflows periodically until ctx is done.
+func (e *WorkflowRecoverer) Run(ctx context.Context) error {
+	e.Recover(ctx)
+
+	interval := e.conf.Workflows.RecoveryInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Recover(ctx)
+		case <-ctx.Done():
+			e.logger.Info("workflow recovery is shut down")
+			return nil
+		}
+	}
+}
+
+// Recover resumes the workflows not updated for StaleAfter,
+// in progress workflows being left to their request.
+func (e *WorkflowRecoverer) Recover(ctx context.Context) {
+	workflows, err := e.workflows.ListWorkflows(ctx)
+	if err != nil {
+		e.logger.WithError(err).Error("an error occured while listing workflows")
+		return
+	}
+
+	for i := range workflows {
+		workflow := &workflows[i]
+		if time.Since(workflow.UpdatedAt) < e.conf.Workflows.StaleAfter {
+			continue
+		}
+
+		logger := e.logger.WithRequestID(workflow.RequestID)
+		err = e.resume(ctx, workflow)
+
+		if err != nil {
+			logger.WithError(err).Warnf("an error occured while recovering %s workflow %s",
+				workflow.Kind, workflow.ID)
+			continue
+		}
+
+		logger.Infof("recovered %s workflow %s", workflow.Kind, workflow.ID)
+	}
+}
+
+// resume resumes a workflow within a span linked to its request.
+func (e *WorkflowRecoverer) resume(ctx context.Context, workflow *storage.Workflow) error {
+	ctx = logging.NewRequestIDContext(ctx, workflow.RequestID)
+	ctx, span := tracing.StartSpan(ctx, "recover "+workflow.Kind+" workflow", tracing.SpanKindInternal)
+	defer span.End()
+
+	span.SetAttribute("workflow_id", workflow.ID)
+	span.SetAttribute("workflow_step", workflow.Step)
+	if origin, ok := tracing.ParseSpanContext(workflow.Trace); ok {
+		span.AddLink(origin)
+	}
+
+	var err error
+	switch workflow.Kind {
+	case startTripWorkflow:
+		err = rollbackStartTrip(ctx, e.conf, e.workflows, workflow, e.logger)
+	case endTripWorkflow:
+		err = resumeEndTrip(ctx, e.conf, e.workflows, workflow)
+	default:
+		err = errors.Errorf("unknown workflow kind: %s", workflow.Kind)
+	}
+
+	span.SetError(err)
+	return err
+}
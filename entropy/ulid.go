@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/oklog/ulid"
@@ -31,20 +33,26 @@ func NewContext(ctx context.Context, id IDGenerator) context.Context {
 	return context.WithValue(ctx, key, id)
 }
 
-// NewIDGenerator creates an IDGenerator.
+// NewIDGenerator creates an IDGenerator, seeded with the current time
+// so that the services and their replicas do not generate the same ids.
 func NewIDGenerator() IDGenerator {
-	t := time.Unix(1000000, 0)
 	return &muon{
-		entropy: rand.New(rand.NewSource(t.UnixNano())),
+		entropy: rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// muon guards its entropy, which is not safe
+// for concurrent use, as requests share it.
 type muon struct {
+	mutex   sync.Mutex
 	entropy io.Reader
 }
 
 // NewID returns a new ID.
 func (e *muon) NewID() string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
 	return ulid.MustNew(ulid.Timestamp(time.Now()), e.entropy).String()
 }
 
@@ -52,3 +60,21 @@ func (e *muon) NewID() string {
 func (e *muon) Compare(a, b string) int {
 	return ulid.MustParse(a).Compare(ulid.MustParse(b))
 }
+
+// crockford is the alphabet of the ulids, in upper case.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// IsValidID tells whether id is a ulid, as generated by an IDGenerator.
+func IsValidID(id string) bool {
+	if len(id) != ulid.EncodedSize || id[0] > '7' {
+		return false
+	}
+
+	for _, c := range strings.ToUpper(id) {
+		if !strings.ContainsRune(crockford, c) {
+			return false
+		}
+	}
+
+	return true
+}
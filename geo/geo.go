@@ -0,0 +1,62 @@
+package geo
+
+import (
+	"math"
+)
+
+// EarthRadius is the mean radius of the Earth, in meters.
+const EarthRadius = 6371008.8
+
+// Distance returns the great-circle distance in meters
+// between two points, with the haversine formula.
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := radians(lat1)
+	phi2 := radians(lat2)
+	deltaPhi := radians(lat2 - lat1)
+	deltaLambda := radians(lng2 - lng1)
+
+	a := math.Pow(math.Sin(deltaPhi/2), 2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Pow(math.Sin(deltaLambda/2), 2)
+
+	return 2 * EarthRadius * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// BoundingBox returns the smallest latitude and longitude ranges
+// containing every point within radius meters of the given point.
+// The longitude range spans the whole globe near the poles
+// or when the circle crosses the antimeridian.
+func BoundingBox(lat, lng, radius float64) (minLat, maxLat, minLng, maxLng float64) {
+	deltaLat := degrees(radius / EarthRadius)
+
+	minLat = math.Max(lat-deltaLat, -90)
+	maxLat = math.Min(lat+deltaLat, 90)
+
+	if minLat == -90 || maxLat == 90 {
+		return minLat, maxLat, -180, 180
+	}
+
+	deltaLng := degrees(radius / (EarthRadius * math.Cos(radians(lat))))
+
+	minLng = lng - deltaLng
+	maxLng = lng + deltaLng
+
+	if minLng < -180 || maxLng > 180 {
+		return minLat, maxLat, -180, 180
+	}
+
+	return minLat, maxLat, minLng, maxLng
+}
+
+// ValidCoordinates tells whether a latitude and a longitude
+// are within their ranges.
+func ValidCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
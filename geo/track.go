@@ -0,0 +1,53 @@
+package geo
+
+import (
+	"time"
+)
+
+// Point is a location recorded at a given time.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+	Time      time.Time
+}
+
+// Summary describes a track.
+type Summary struct {
+	// Distance in meters.
+	Distance float64
+	Duration time.Duration
+
+	// Speeds in meters per second.
+	AverageSpeed float64
+	MaxSpeed     float64
+}
+
+// Summarize computes the summary of a track
+// whose points are ordered by time.
+// Segments without elapsed time do not count for the max speed.
+func Summarize(points []Point) Summary {
+	summary := Summary{}
+	if len(points) < 2 {
+		return summary
+	}
+
+	for i := 1; i < len(points); i++ {
+		previous, current := points[i-1], points[i]
+
+		distance := Distance(previous.Latitude, previous.Longitude,
+			current.Latitude, current.Longitude)
+		summary.Distance += distance
+
+		elapsed := current.Time.Sub(previous.Time).Seconds()
+		if elapsed > 0 && distance/elapsed > summary.MaxSpeed {
+			summary.MaxSpeed = distance / elapsed
+		}
+	}
+
+	summary.Duration = points[len(points)-1].Time.Sub(points[0].Time)
+	if summary.Duration > 0 {
+		summary.AverageSpeed = summary.Distance / summary.Duration.Seconds()
+	}
+
+	return summary
+}
@@ -0,0 +1,131 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sony/gobreaker"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/stats"
+)
+
+// CircuitOpenError is returned instead of calling an upstream
+// deemed unavailable.
+type CircuitOpenError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of %s service is open", e.Upstream)
+}
+
+// RetryAfterSeconds returns RetryAfter in whole seconds, at least one.
+func (e *CircuitOpenError) RetryAfterSeconds() int64 {
+	return int64(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// IsCircuitOpen tells whether err comes from an open circuit breaker,
+// as returned by an http client.
+func IsCircuitOpen(err error) (*CircuitOpenError, bool) {
+	cause := errors.Cause(err)
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = errors.Cause(urlErr.Err)
+	}
+
+	open, ok := cause.(*CircuitOpenError)
+	return open, ok
+}
+
+// breakerTransport stops calling an upstream after consecutive failures,
+// until it is probed again once the breaker is half-open.
+// Transport errors and 5xx responses are failures.
+type breakerTransport struct {
+	name     string
+	next     http.RoundTripper
+	breaker  *gobreaker.TwoStepCircuitBreaker
+	timeout  time.Duration
+	openedAt int64
+}
+
+func newBreakerTransport(name string, conf configuration.Breaker, logger logging.Logger,
+	statter stats.Statter, next http.RoundTripper) *breakerTransport {
+
+	e := &breakerTransport{
+		name:    name,
+		next:    next,
+		timeout: conf.OpenTimeout,
+	}
+
+	failures := conf.ConsecutiveFailures
+	if failures == 0 {
+		failures = configuration.DefaultUpstream.Breaker.ConsecutiveFailures
+	}
+
+	e.breaker = gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: conf.HalfOpenRequests,
+		Timeout:     conf.OpenTimeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= failures
+		},
+		OnStateChange: func(_ string, from, to gobreaker.State) {
+			if to == gobreaker.StateOpen {
+				atomic.StoreInt64(&e.openedAt, time.Now().UnixNano())
+			}
+
+			logger.WithField("upstream", name).
+				Warnf("circuit breaker went from %s to %s", from, to)
+
+			state := strings.Replace(to.String(), "-", "_", -1)
+			_ = statter.Inc("upstream."+name+".breaker."+state, 1, 1.0)
+			_ = statter.Gauge("upstream."+name+".breaker.state", int64(to), 1.0)
+		},
+	})
+
+	return e
+}
+
+func (e *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := e.breaker.Allow()
+	if err != nil {
+		return nil, &CircuitOpenError{
+			Upstream:   e.name,
+			RetryAfter: e.retryAfter(),
+		}
+	}
+
+	resp, err := e.next.RoundTrip(req)
+
+	// a call given up by its caller says nothing about the upstream,
+	// unlike one the upstream did not answer before its deadline.
+	canceled := err != nil && req.Context().Err() == context.Canceled
+	done(canceled || (err == nil && resp.StatusCode < http.StatusInternalServerError))
+
+	return resp, err
+}
+
+// retryAfter estimates when the breaker lets requests through again.
+func (e *breakerTransport) retryAfter() time.Duration {
+	if e.breaker.State() == gobreaker.StateHalfOpen {
+		return time.Second
+	}
+
+	timeout := e.timeout
+	if timeout <= 0 {
+		// the gobreaker default.
+		timeout = 60 * time.Second
+	}
+
+	openedAt := time.Unix(0, atomic.LoadInt64(&e.openedAt))
+	return timeout - time.Since(openedAt)
+}
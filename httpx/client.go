@@ -1,20 +1,208 @@
 package httpx
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
 	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/stats"
+	"github.com/EarvinKayonga/rider/tracing"
 )
 
-// Client is a http client with a good timeout.
-func Client() *http.Client {
+// NewClient returns the http client of an upstream,
+// meant to be shared by every call to it.
+// Its requests are reported to statter under upstream.<name>.
+func NewClient(name string, conf configuration.Upstream,
+	logger logging.Logger, statter stats.Statter) (*http.Client, error) {
+
+	tlsConfig, err := newTLSConfig(conf)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while configuring tls for upstream: %s", name)
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   conf.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: conf.TLSHandshakeTimeout,
+		MaxIdleConns:        conf.MaxIdleConns,
+		MaxIdleConnsPerHost: conf.MaxIdleConnsPerHost,
+		IdleConnTimeout:     conf.IdleConnTimeout,
+	}
+
 	return &http.Client{
-		Timeout: time.Second * 10,
-		Transport: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout: 5 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 5 * time.Second,
+		Timeout: conf.Timeout,
+		Transport: &retryTransport{
+			name:    name,
+			conf:    conf.Retry,
+			statter: statter,
+			next: newBreakerTransport(name, conf.Breaker, logger, statter,
+				&instrumentedTransport{
+					name:    name,
+					next:    transport,
+					statter: statter,
+				}),
 		},
+	}, nil
+}
+
+// RequestIDHeader correlates the requests made
+// on behalf of a same client request.
+const RequestIDHeader = "X-Request-ID"
+
+// Get issues a GET bound to ctx.
+func Get(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := newRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return do(ctx, client, req)
+}
+
+// Post issues a POST bound to ctx.
+func Post(ctx context.Context, client *http.Client, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := newRequest(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	return do(ctx, client, req)
+}
+
+// newRequest creates a request bound to ctx,
+// forwarding its request id.
+func newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while creating request")
+	}
+
+	if id := logging.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// do sends req within a client span,
+// propagated to the upstream.
+func do(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.StartSpan(ctx, req.Method+" "+req.URL.Host, tracing.SpanKindClient)
+	defer span.End()
+
+	span.SetAttribute("http.method", req.Method)
+	// the query is left out, as it may hold the location of a rider.
+	target := *req.URL
+	target.User, target.RawQuery, target.ForceQuery = nil, "", false
+	span.SetAttribute("http.url", target.String())
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(errors.New(resp.Status))
 	}
+
+	return resp, nil
+}
+
+// newTLSConfig returns the tls configuration of an upstream,
+// nil for the defaults.
+func newTLSConfig(conf configuration.Upstream) (*tls.Config, error) {
+	if conf.CACert == "" && conf.Certificate == "" && !conf.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+
+	if conf.CACert != "" {
+		pem, err := ioutil.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"an error occured while reading ca certificate: %s", conf.CACert)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in %s", conf.CACert)
+		}
+	}
+
+	if conf.Certificate != "" {
+		certificate, err := tls.LoadX509KeyPair(conf.Certificate, conf.PrivateKey)
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"an error occured while loading client certificate: %s", conf.Certificate)
+		}
+
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// instrumentedTransport reports the latency, errors
+// and connection usage of an upstream.
+type instrumentedTransport struct {
+	name     string
+	next     http.RoundTripper
+	statter  stats.Statter
+	inFlight int64
+}
+
+func (e *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	_ = e.statter.Gauge(e.stat("inflight"), atomic.AddInt64(&e.inFlight, 1), 1.0)
+	defer func() {
+		_ = e.statter.Gauge(e.stat("inflight"), atomic.AddInt64(&e.inFlight, -1), 1.0)
+		_ = e.statter.TimingDuration(e.stat("timing"), time.Since(start), 1.0)
+		_ = e.statter.Inc(e.stat("request"), 1, 1.0)
+	}()
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				_ = e.statter.Inc(e.stat("conn.reused"), 1, 1.0)
+				return
+			}
+
+			_ = e.statter.Inc(e.stat("conn.new"), 1, 1.0)
+		},
+	}
+
+	resp, err := e.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		_ = e.statter.Inc(e.stat("error"), 1, 1.0)
+	}
+
+	return resp, err
+}
+
+func (e *instrumentedTransport) stat(name string) string {
+	return "upstream." + e.name + "." + name
 }
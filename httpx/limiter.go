@@ -1,46 +1,133 @@
 package httpx
 
 import (
-	"net/http"
+	"container/list"
+	"math"
+	"sync"
+	"time"
 
-	"golang.org/x/time/rate"
+	"github.com/EarvinKayonga/rider/configuration"
 )
 
-// example https://www.alexedwards.net/blog/how-to-rate-limit-http-requests
-
-// A Limiter controls how frequently events are allowed to happen.
-// It implements a "token bucket" of size b, initially full and
-// refilled at rate r tokens per second.
-//
-// func NewLimiter(r Limit, b int) *Limiter
-// the limiter permits you to consume an average of r tokens per second,
-// with a maximum of b tokens in any single 'burst'.
-// So in the code above our limiter allows 10 tokens to be consumed per second,
-// with a maximum burst size of 20.
-// var limiter = rate.NewLimiter(10, 20)
-
-const (
-	defaultLimit = 10
-	defaultBurst = 20
-)
+// RateLimit is the outcome of rate limiting a request.
+type RateLimit struct {
+	Allowed bool
+
+	// Limit is the size of the bucket, and Remaining
+	// the tokens left in it, both zero when not limited.
+	Limit     int
+	Remaining int
+
+	// RetryAfter is the wait before a token is available
+	// again, when the request is not allowed.
+	RetryAfter time.Duration
+}
+
+// RetryAfterSeconds rounds RetryAfter up to the second,
+// as expected by the Retry-After header.
+func (r RateLimit) RetryAfterSeconds() int64 {
+	return int64(math.Ceil(r.RetryAfter.Seconds()))
+}
+
+// RateLimiter limits the requests of each client with a token bucket,
+// which is refilled at Limit tokens per second and holds up to Burst tokens.
+// A route with a policy of its own has buckets of its own,
+// the other routes sharing the buckets of the default policy.
+// Once Size buckets are kept, the least recently used one is evicted.
+type RateLimiter struct {
+	conf configuration.Limiter
+	now  func() time.Time
+
+	mutex   sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
 
-// Limiter is a simple parameterized rate limiting implementation.
-func Limiter(limit float64, burst int) func(next http.Handler) http.Handler {
-	if limit < defaultLimit || burst < defaultBurst {
-		limit = defaultLimit
-		burst = defaultBurst
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter following conf.
+func NewRateLimiter(conf configuration.Limiter) *RateLimiter {
+	if conf.Size <= 0 {
+		conf.Size = configuration.DefaultLimiter.Size
+	}
+
+	return &RateLimiter{
+		conf:    conf,
+		now:     time.Now,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
 	}
+}
 
-	var limiter = rate.NewLimiter(rate.Limit(limit), burst)
+// Allow takes a token from the bucket of a client for route.
+// Routes whose policy has no positive Limit are not limited.
+func (e *RateLimiter) Allow(route, client string) RateLimit {
+	policy, own := e.conf.PolicyFor(route)
+	if policy.Limit <= 0 {
+		return RateLimit{
+			Allowed: true,
+		}
+	}
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !limiter.Allow() {
-				http.Error(w, http.StatusText(429), http.StatusTooManyRequests)
-				return
-			}
+	burst := float64(policy.Burst)
+	if burst < 1 {
+		burst = 1
+	}
 
-			next.ServeHTTP(w, r)
-		})
+	key := client
+	if own {
+		key = route + " " + client
 	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := e.now()
+	b := e.bucket(key, burst, now)
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*policy.Limit)
+	b.last = now
+
+	limit := RateLimit{
+		Limit: int(burst),
+	}
+
+	if b.tokens < 1 {
+		limit.RetryAfter = time.Duration((1 - b.tokens) / policy.Limit * float64(time.Second))
+		return limit
+	}
+
+	b.tokens--
+
+	limit.Allowed = true
+	limit.Remaining = int(b.tokens)
+	return limit
+}
+
+// bucket returns the bucket of key, full when new,
+// marking it as the most recently used.
+func (e *RateLimiter) bucket(key string, burst float64, now time.Time) *bucket {
+	if element, ok := e.buckets[key]; ok {
+		e.lru.MoveToFront(element)
+		return element.Value.(*bucket)
+	}
+
+	for e.lru.Len() >= e.conf.Size {
+		oldest := e.lru.Back()
+		e.lru.Remove(oldest)
+		delete(e.buckets, oldest.Value.(*bucket).key)
+	}
+
+	b := &bucket{
+		key:    key,
+		tokens: burst,
+		last:   now,
+	}
+
+	e.buckets[key] = e.lru.PushFront(b)
+	return b
 }
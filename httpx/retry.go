@@ -0,0 +1,144 @@
+package httpx
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/stats"
+)
+
+var errRetryCanceled = errors.New("request canceled while waiting to retry")
+
+// Idempotent marks the requests made with ctx as safe to retry.
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey).(bool)
+	return idempotent
+}
+
+// retryTransport retries idempotent requests failing on transport errors
+// or on responses telling the upstream is unavailable.
+type retryTransport struct {
+	name    string
+	next    http.RoundTripper
+	conf    configuration.Retry
+	statter stats.Statter
+}
+
+func (e *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if e.conf.Attempts <= 1 || !isIdempotent(req.Context()) ||
+		(req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+
+		return e.next.RoundTrip(req)
+	}
+
+	attempt := req
+	for retry := 1; ; retry++ {
+		resp, err := e.next.RoundTrip(attempt)
+		if retry >= e.conf.Attempts || !isRetriable(req, resp, err) {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		if !wait(req, e.backoff(retry)) {
+			return nil, errRetryCanceled
+		}
+
+		attempt, err = rewind(req)
+		if err != nil {
+			return nil, err
+		}
+
+		_ = e.statter.Inc("upstream."+e.name+".retry", 1, 1.0)
+	}
+}
+
+// backoff returns a random delay up to BaseDelay * 2^(retry-1).
+func (e *retryTransport) backoff(retry int) time.Duration {
+	delay := e.conf.BaseDelay << uint(retry-1)
+	if delay <= 0 || (e.conf.MaxDelay > 0 && delay > e.conf.MaxDelay) {
+		delay = e.conf.MaxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+func isRetriable(req *http.Request, resp *http.Response, err error) bool {
+	if isCanceled(req) {
+		return false
+	}
+
+	if err != nil {
+		_, open := err.(*CircuitOpenError)
+		return !open
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait sleeps for delay, unless req is canceled first.
+func wait(req *http.Request, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		return false
+	case <-req.Cancel:
+		return false
+	}
+}
+
+func isCanceled(req *http.Request) bool {
+	if req.Context().Err() != nil {
+		return true
+	}
+
+	select {
+	case <-req.Cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// rewind copies req with a fresh body.
+func rewind(req *http.Request) (*http.Request, error) {
+	attempt := req.WithContext(req.Context())
+	if req.GetBody == nil {
+		return attempt, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, errors.Wrap(err, "an error occured while rewinding request body")
+	}
+
+	attempt.Body = body
+	return attempt, nil
+}
@@ -0,0 +1,67 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/stats"
+)
+
+const (
+	key           = keyType("upstreams")
+	idempotentKey = keyType("idempotent")
+)
+
+type keyType string
+
+// Upstreams holds the clients of the services
+// called by the gateway.
+type Upstreams struct {
+	Bike *http.Client
+	Trip *http.Client
+}
+
+// NewUpstreams creates the clients of the gateway upstreams.
+func NewUpstreams(conf configuration.GatewayConfiguration,
+	logger logging.Logger, statter stats.Statter) (*Upstreams, error) {
+
+	bike, err := NewClient("bike", conf.Upstreams.Bike, logger, statter)
+	if err != nil {
+		return nil, err
+	}
+
+	trip, err := NewClient("trip", conf.Upstreams.Trip, logger, statter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Upstreams{
+		Bike: bike,
+		Trip: trip,
+	}, nil
+}
+
+// defaultUpstreams are the clients of a context without Upstreams,
+// bounded by the timeout of DefaultUpstream.
+var defaultUpstreams = &Upstreams{
+	Bike: &http.Client{Timeout: configuration.DefaultUpstream.Timeout},
+	Trip: &http.Client{Timeout: configuration.DefaultUpstream.Timeout},
+}
+
+// UpstreamsFromContext extracts the Upstreams from the Context,
+// falling back to plain clients when it has none.
+func UpstreamsFromContext(ctx context.Context) *Upstreams {
+	upstreams, ok := ctx.Value(key).(*Upstreams)
+	if !ok || upstreams == nil {
+		return defaultUpstreams
+	}
+
+	return upstreams
+}
+
+// NewContext adds the given Upstreams to the Context.
+func NewContext(ctx context.Context, upstreams *Upstreams) context.Context {
+	return context.WithValue(ctx, key, upstreams)
+}
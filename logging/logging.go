@@ -13,7 +13,8 @@ import (
 type keyType string
 
 const (
-	key = keyType("logging")
+	key          = keyType("logging")
+	requestIDKey = keyType("request_id")
 )
 
 // NewLogger creates a logger instance.
@@ -41,7 +42,25 @@ func NewLogger(conf configuration.Logging) *Logger {
 
 // Logger is a logging abstraction.
 type Logger struct {
-	*logrus.Logger
+	logrus.FieldLogger
+}
+
+// WithRequestID returns a Logger adding the id
+// of the request being handled to its entries.
+func (l Logger) WithRequestID(id string) Logger {
+	if id == "" {
+		return l
+	}
+
+	return Logger{
+		l.WithField("request_id", id),
+	}
+}
+
+// WithContext returns a Logger adding the request id
+// of the Context to its entries.
+func (l Logger) WithContext(ctx context.Context) Logger {
+	return l.WithRequestID(RequestIDFromContext(ctx))
 }
 
 // FromContext extracts a Logger from the Context.
@@ -53,3 +72,15 @@ func FromContext(ctx context.Context) *Logger {
 func NewContext(ctx context.Context, l *Logger) context.Context {
 	return context.WithValue(ctx, key, l)
 }
+
+// RequestIDFromContext extracts the request id from the Context,
+// empty when there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// NewRequestIDContext adds the given request id to the Context.
+func NewRequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
@@ -0,0 +1,207 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/tracing"
+)
+
+// BatchHandler handles a batch of messages at once.
+// The messages it did not reject are acknowledged when it succeeds,
+// and otherwise handled again by halves, the ones failing on their own
+// being requeued until their last attempt sends them
+// to the dead letter topic.
+type BatchHandler func(ctx context.Context, messages []*Message) error
+
+type batchConsumer struct {
+	Topic    string
+	Channel  string
+	Size     int
+	Interval time.Duration
+	Handler  BatchHandler
+
+	driver     string
+	subscriber subscriber
+	failures   *failures
+	messages   chan *Message
+	logger     logging.Logger
+}
+
+func (e *batchConsumer) Run(ctx context.Context) error {
+	errs := make(chan error, 1)
+
+	go func() {
+		// a batch can only fill up
+		// when the backend delivers enough messages at once.
+		err := e.subscriber.subscribe(ctx, e.Topic, e.Channel, e.Size, func(message *Message) {
+			e.messages <- e.failures.watch(ctx, message)
+		})
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	e.logger.Infof(
+		"launching batch event consumer, topic: %s, channel: %s, batch size: %d, interval: %s",
+		e.Topic, e.Channel, e.Size, e.Interval)
+
+	return e.batch(ctx, errs)
+}
+
+// batch groups messages until a batch is full or its interval elapsed.
+func (e *batchConsumer) batch(ctx context.Context, errs chan error) error {
+	pending := make([]*Message, 0, e.Size)
+
+	timer := time.NewTimer(e.Interval)
+	timer.Stop()
+
+	for {
+		select {
+		case message := <-e.messages:
+			if len(pending) == 0 {
+				timer.Reset(e.Interval)
+			}
+
+			pending = append(pending, message)
+			if len(pending) < e.Size {
+				continue
+			}
+
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+			e.flush(ctx, pending)
+			pending = make([]*Message, 0, e.Size)
+
+		case <-timer.C:
+			e.flush(ctx, pending)
+			pending = make([]*Message, 0, e.Size)
+
+		case err := <-errs:
+			return err
+
+		case <-ctx.Done():
+			for _, message := range pending {
+				message.Requeue(-1)
+			}
+
+			e.logger.Info("batch event consumer is shut down")
+			return nil
+		}
+	}
+}
+
+func (e *batchConsumer) flush(ctx context.Context, messages []*Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "consume "+e.Topic, tracing.SpanKindConsumer)
+	defer span.End()
+
+	span.SetAttribute("messaging.system", e.driver)
+	span.SetAttribute("messaging.destination", e.Topic)
+	span.SetAttribute("messaging.batch.message_count", len(messages))
+
+	span.SetError(e.handle(ctx, messages))
+}
+
+// handle handles the unanswered messages, handling them again by halves
+// when they fail, so that a message failing on its own does not send
+// the others of its batch to the dead letter topic.
+// It returns the error of the messages which failed, if any.
+func (e *batchConsumer) handle(ctx context.Context, messages []*Message) error {
+	unanswered := make([]*Message, 0, len(messages))
+	for _, message := range messages {
+		if !message.answered() {
+			unanswered = append(unanswered, message)
+		}
+	}
+
+	if len(unanswered) == 0 {
+		return nil
+	}
+
+	err := e.Handler(ctx, unanswered)
+	if err == nil {
+		for _, message := range unanswered {
+			message.Ack()
+		}
+
+		return nil
+	}
+
+	if len(unanswered) == 1 || ctx.Err() != nil {
+		e.logger.
+			WithError(err).
+			Errorf("an error occured while handling a batch of %d messages", len(unanswered))
+
+		for _, message := range unanswered {
+			e.failures.fail(ctx, message, err)
+		}
+
+		return err
+	}
+
+	e.logger.
+		WithError(err).
+		Warnf("an error occured while handling a batch of %d messages, handling it by halves", len(unanswered))
+
+	half := len(unanswered) / 2
+	first := e.handle(ctx, unanswered[:half])
+	second := e.handle(ctx, unanswered[half:])
+	if first != nil {
+		return first
+	}
+
+	return second
+}
+
+// NewBatchConsumer returns a valid event consumer
+// handling messages by batches.
+func NewBatchConsumer(ctx context.Context, conf configuration.Consumption,
+	logger logging.Logger, handler BatchHandler) (Consumer, error) {
+
+	size := conf.BatchSize
+	if size <= 0 {
+		size = configuration.DefaultBatchSize
+	}
+
+	interval := conf.BatchInterval
+	if interval <= 0 {
+		interval = configuration.DefaultBatchInterval
+	}
+
+	sub, err := newSubscriber(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	failures, err := newFailures(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := conf.Driver
+	if driver == "" {
+		driver = configuration.NSQDriver
+	}
+
+	return &batchConsumer{
+		Topic:    conf.Topic,
+		Channel:  conf.Channel,
+		Size:     size,
+		Interval: interval,
+		Handler:  handler,
+
+		driver:     driver,
+		subscriber: sub,
+		failures:   failures,
+		messages:   make(chan *Message, size),
+		logger:     logger,
+	}, nil
+}
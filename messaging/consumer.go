@@ -2,11 +2,8 @@ package messaging
 
 import (
 	"context"
-	"fmt"
-	"math/rand"
 
 	"github.com/pkg/errors"
-	bus "github.com/rafaeljesus/nsq-event-bus"
 
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/logging"
@@ -19,53 +16,73 @@ type Consumer interface {
 }
 
 type consumer struct {
-	Address     string
-	Topic       string
-	HandlerFunc func(*bus.Message) (reply interface{}, err error)
+	Topic   string
+	Channel string
+	Handler Handler
 
-	logger logging.Logger
+	subscriber subscriber
+	failures   *failures
+	logger     logging.Logger
 }
 
-func (e consumer) Run(ctx context.Context) error {
-	errs := make(chan error, 1)
+func (e *consumer) Run(ctx context.Context) error {
+	e.logger.Infof("launching event consumer, topic: %s, channel: %s", e.Topic, e.Channel)
 
-	go func() {
-		err := bus.On(bus.ListenerConfig{
-			Lookup:      []string{e.Address},
-			Topic:       e.Topic,
-			Channel:     fmt.Sprintf("consumer%d", rand.Intn(100)),
-			HandlerFunc: e.HandlerFunc,
-		})
+	err := e.subscriber.subscribe(ctx, e.Topic, e.Channel, 1, func(message *Message) {
+		message = e.failures.watch(ctx, message)
 
+		err := e.Handler(ctx, message)
 		if err != nil {
-			errs <- errors.Wrapf(err,
-				"an error occured while setting consumer at %s", e.Address)
+			e.failures.fail(ctx, message, err)
+			return
 		}
-	}()
-
-	e.logger.Infof(
-		"launching event consumer at %s, topic: %s, channel: %s",
-		e.Address, e.Topic, "rider")
-
-	select {
-	case err := <-errs:
-		return err
-	case <-ctx.Done():
-		e.logger.Info("event consumer is shut down")
-		return nil
-	}
+
+		message.Ack()
+	})
+
+	e.logger.Info("event consumer is shut down")
+	return err
 }
 
 // NewConsumer returns a valid event consumer.
 func NewConsumer(ctx context.Context, conf configuration.Consumption,
-	logger logging.Logger,
-	handler func(*bus.Message) (reply interface{}, err error)) (Consumer, error) {
+	logger logging.Logger, handler Handler) (Consumer, error) {
+
+	sub, err := newSubscriber(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	failures, err := newFailures(conf, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	return &consumer{
-		Address:     conf.Address,
-		Topic:       conf.Topic,
-		HandlerFunc: handler,
+		Topic:   conf.Topic,
+		Channel: conf.Channel,
+		Handler: handler,
 
-		logger: logger,
+		subscriber: sub,
+		failures:   failures,
+		logger:     logger,
 	}, nil
 }
+
+// newSubscriber returns the subscriber of the configured backend.
+func newSubscriber(conf configuration.Consumption) (subscriber, error) {
+	if conf.Channel == "" {
+		return nil, errors.Errorf("a channel is required to consume %s", conf.Topic)
+	}
+
+	switch conf.Driver {
+	case configuration.MemoryDriver:
+		return inProcess, nil
+	case "", configuration.NSQDriver:
+		return &nsqSubscriber{
+			address: conf.Address,
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown messaging driver: %s", conf.Driver)
+	}
+}
@@ -0,0 +1,182 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+)
+
+// DeadLetter is a message given up on by the consumers of a channel,
+// published to the dead letter topic with the reason of its last failure.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Topic    string    `json:"topic"`
+	Channel  string    `json:"channel"`
+	Attempts int       `json:"attempts"`
+	Reason   string    `json:"reason"`
+	FailedAt time.Time `json:"failed_at"`
+
+	// Body is the message, unless it is not json,
+	// in which case Raw holds it.
+	Body json.RawMessage `json:"body,omitempty"`
+	Raw  []byte          `json:"raw,omitempty"`
+}
+
+// payload returns the body of the message given up on.
+func (d DeadLetter) payload() []byte {
+	if len(d.Body) > 0 {
+		return d.Body
+	}
+
+	return d.Raw
+}
+
+// failures answers the messages whose handling failed,
+// requeuing them with an exponential backoff
+// until their last attempt sends them to the dead letter topic.
+type failures struct {
+	channel string
+	topic   string
+	retry   configuration.Retry
+
+	publisher publisher
+	logger    logging.Logger
+}
+
+// newFailures returns the failures of the consumers of conf,
+// publishing their dead letters through the configured backend.
+func newFailures(conf configuration.Consumption, logger logging.Logger) (*failures, error) {
+	pub, err := newDeadLetterPublisher(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := conf.Retry
+	if retry.Attempts <= 0 {
+		retry = configuration.DefaultConsumerRetry
+	}
+
+	return &failures{
+		channel: conf.Channel,
+		topic:   conf.DeadLetterTopic(),
+		retry:   retry,
+
+		publisher: pub,
+		logger:    logger,
+	}, nil
+}
+
+// newDeadLetterPublisher returns the publisher of the dead letters,
+// waiting for nsqd so that a message is only acknowledged once buried.
+func newDeadLetterPublisher(conf configuration.Consumption) (publisher, error) {
+	switch conf.Driver {
+	case configuration.MemoryDriver:
+		return inProcess, nil
+	case "", configuration.NSQDriver:
+		if conf.DeadLetter.Address == "" {
+			return nil, errors.New("an address is required to publish dead letters")
+		}
+
+		nsq, err := newNSQPublisher(configuration.Emission{
+			Address:      conf.DeadLetter.Address,
+			MaxInFlight:  1,
+			Acknowledged: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return nsq, nil
+	default:
+		return nil, errors.Errorf("unknown messaging driver: %s", conf.Driver)
+	}
+}
+
+// watch lets a message be rejected, burying it right away.
+func (e *failures) watch(ctx context.Context, message *Message) *Message {
+	message.reject = func(reason error) {
+		e.bury(ctx, message, reason)
+	}
+
+	return message
+}
+
+// fail answers a message whose handling failed with reason.
+func (e *failures) fail(ctx context.Context, message *Message, reason error) {
+	if !message.answer() {
+		return
+	}
+
+	if message.Attempts >= e.retry.Attempts {
+		e.bury(ctx, message, reason)
+		return
+	}
+
+	delay := e.backoff(message.Attempts)
+	e.logger.
+		WithError(reason).
+		Warnf("an error occured while handling message %s (attempt %d of %d), requeuing it in %s",
+			message.ID, message.Attempts, e.retry.Attempts, delay)
+
+	message.requeue(delay)
+}
+
+// backoff returns the delay before the attempt following attempts.
+func (e *failures) backoff(attempts int) time.Duration {
+	delay := e.retry.BaseDelay
+	for i := 1; i < attempts && delay < e.retry.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if e.retry.MaxDelay > 0 && delay > e.retry.MaxDelay {
+		delay = e.retry.MaxDelay
+	}
+
+	return delay
+}
+
+// bury publishes an answered message to the dead letter topic,
+// and acknowledges it. It is requeued when publishing fails.
+func (e *failures) bury(ctx context.Context, message *Message, reason error) {
+	letter := DeadLetter{
+		ID:       message.ID,
+		Topic:    message.Topic,
+		Channel:  e.channel,
+		Attempts: message.Attempts,
+		Reason:   reason.Error(),
+		FailedAt: time.Now().UTC(),
+	}
+
+	if json.Valid(message.Body) {
+		letter.Body = message.Body
+	} else {
+		letter.Raw = message.Body
+	}
+
+	logger := e.logger.WithError(reason)
+
+	body, err := json.Marshal(letter)
+	if err == nil {
+		err = e.publisher.publish(ctx, e.topic, body)
+	}
+
+	if err != nil {
+		logger.
+			WithField("dead_letter_error", err.Error()).
+			Errorf("an error occured while sending message %s to %s, requeuing it",
+				message.ID, e.topic)
+
+		message.requeue(e.backoff(message.Attempts))
+		return
+	}
+
+	logger.Errorf("message %s sent to %s after %d attempts",
+		message.ID, e.topic, message.Attempts)
+
+	message.ack()
+}
@@ -0,0 +1,94 @@
+package messaging
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/logging"
+)
+
+// Event is an event received in a message.
+type Event struct {
+	Envelope
+	Message *Message
+}
+
+// EventHandler handles a batch of events of a single type.
+// Their messages are acknowledged when it succeeds, unless rejected.
+type EventHandler func(ctx context.Context, events []Event) error
+
+// Dispatch returns a BatchHandler handing the events of a batch
+// to the handler of their type. The events of types without handler
+// are acknowledged, being for the other consumers of the topic.
+// Messages which are not events of the catalog, or of versions
+// no longer supported, are rejected. Those of versions not supported yet
+// fail, waiting for a consumer supporting them.
+func Dispatch(logger logging.Logger, handlers map[EventType]EventHandler) BatchHandler {
+	byName := make(map[string]EventHandler, len(handlers))
+	for event, handler := range handlers {
+		byName[event.Name] = handler
+	}
+
+	return func(ctx context.Context, messages []*Message) error {
+		batches := map[string][]Event{}
+		types := []string{}
+		newer := 0
+
+		for _, message := range messages {
+			envelope, err := message.Open()
+			if errors.Cause(err) == ErrNewerVersion {
+				newer++
+				continue
+			}
+
+			if err != nil {
+				logger.
+					WithError(err).
+					Errorf("an error occured while opening message %s", message.ID)
+
+				message.Reject(err)
+				continue
+			}
+
+			if _, ok := byName[envelope.Type]; !ok {
+				logger.Debugf("ignoring %s event %s", envelope.Type, envelope.ID)
+
+				message.Ack()
+				continue
+			}
+
+			if _, ok := batches[envelope.Type]; !ok {
+				types = append(types, envelope.Type)
+			}
+
+			batches[envelope.Type] = append(batches[envelope.Type], Event{
+				Envelope: envelope,
+				Message:  message,
+			})
+		}
+
+		var failure error
+		for _, name := range types {
+			events := batches[name]
+
+			err := byName[name](ctx, events)
+			if err != nil {
+				failure = errors.Wrapf(err,
+					"an error occured while handling %d %s events", len(events), name)
+
+				continue
+			}
+
+			for _, event := range events {
+				event.Message.Ack()
+			}
+		}
+
+		if failure == nil && newer > 0 {
+			failure = errors.Wrapf(ErrNewerVersion, "%d events", newer)
+		}
+
+		return failure
+	}
+}
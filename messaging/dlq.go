@@ -0,0 +1,163 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+)
+
+// DeadLetterQueue reads the dead letter topic of a consumption
+// through its dead letter channel.
+type DeadLetterQueue struct {
+	Topic   string
+	Channel string
+
+	subscriber subscriber
+	publisher  publisher
+}
+
+// NewDeadLetterQueue returns the dead letter queue of a consumption.
+// Only nsq keeps the dead letters apart from the services,
+// those of the memory driver being lost with their process.
+func NewDeadLetterQueue(conf configuration.Consumption) (*DeadLetterQueue, error) {
+	if conf.Driver == configuration.MemoryDriver {
+		return nil, errors.New("the dead letters of the memory driver are not kept")
+	}
+
+	channel := conf.DeadLetter.Channel
+	if channel == "" {
+		channel = configuration.DefaultDeadLetterChannel
+	}
+
+	topic := conf.DeadLetterTopic()
+
+	conf.Channel = channel
+	sub, err := newSubscriber(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := newDeadLetterPublisher(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterQueue{
+		Topic:   topic,
+		Channel: channel,
+
+		subscriber: sub,
+		publisher:  pub,
+	}, nil
+}
+
+// Inspect returns up to limit dead letters, which are left in the queue.
+// It stops waiting once no dead letter arrived for idle.
+func (e *DeadLetterQueue) Inspect(ctx context.Context, limit int, idle time.Duration) ([]DeadLetter, error) {
+	messages, letters, err := e.receive(ctx, limit, idle)
+
+	for _, message := range messages {
+		message.Requeue(0)
+	}
+
+	return letters, err
+}
+
+// Replay publishes up to limit dead letters back to their topic,
+// removing them from the queue. It stops at the first failure,
+// and once no dead letter arrived for idle.
+// A dead letter is replayed at least once.
+func (e *DeadLetterQueue) Replay(ctx context.Context, limit int, idle time.Duration) ([]DeadLetter, error) {
+	messages, letters, err := e.receive(ctx, limit, idle)
+	if err != nil {
+		for _, message := range messages {
+			message.Requeue(0)
+		}
+
+		return nil, err
+	}
+
+	for i, letter := range letters {
+		err := e.publisher.publish(ctx, letter.Topic, letter.payload())
+		if err != nil {
+			for _, message := range messages[i:] {
+				message.Requeue(0)
+			}
+
+			return letters[:i], errors.Wrapf(err,
+				"an error occured while replaying message %s to %s", letter.ID, letter.Topic)
+		}
+
+		messages[i].Ack()
+	}
+
+	return letters, nil
+}
+
+// receive holds up to limit dead letters, until none arrived for idle.
+// The messages are left for the caller to answer.
+func (e *DeadLetterQueue) receive(ctx context.Context, limit int,
+	idle time.Duration) ([]*Message, []DeadLetter, error) {
+
+	if limit <= 0 {
+		limit = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	received := make(chan *Message, limit)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- e.subscriber.subscribe(ctx, e.Topic, e.Channel, limit, func(message *Message) {
+			received <- message
+		})
+	}()
+
+	messages := make([]*Message, 0, limit)
+	letters := make([]DeadLetter, 0, limit)
+
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+
+	for len(messages) < limit {
+		select {
+		case message := <-received:
+			messages = append(messages, message)
+
+			letter := DeadLetter{}
+			err := message.Decode(&letter)
+			if err != nil {
+				return messages, letters, errors.Wrapf(err,
+					"an error occured while decoding dead letter %s", message.ID)
+			}
+
+			letters = append(letters, letter)
+
+			if !timer.Stop() {
+				<-timer.C
+			}
+
+			timer.Reset(idle)
+
+		case <-timer.C:
+			return messages, letters, nil
+
+		case err := <-errs:
+			if err == nil {
+				err = ctx.Err()
+			}
+
+			return messages, letters, err
+
+		case <-ctx.Done():
+			return messages, letters, ctx.Err()
+		}
+	}
+
+	return messages, letters, nil
+}
@@ -2,54 +2,126 @@ package messaging
 
 import (
 	"context"
-	"time"
+	"encoding/json"
+	"net/http"
 
 	"github.com/pkg/errors"
-	bus "github.com/rafaeljesus/nsq-event-bus"
 
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/problem"
+	"github.com/EarvinKayonga/rider/stats"
+	"github.com/EarvinKayonga/rider/tracing"
 )
 
-// Emitter sends message through messaging pipeline.
+// Errors of the emission.
+var (
+	ErrBrokerUnavailable = problem.New("broker_unavailable", http.StatusServiceUnavailable, "messaging broker unavailable")
+	ErrSpoolFull         = problem.New("spool_full", http.StatusServiceUnavailable, "messaging spool full")
+)
+
+// Emitter sends events through messaging pipeline.
 type Emitter interface {
-	Emit(ctx context.Context, payload interface{}) error
+	Emit(ctx context.Context, event EventType, payload interface{}) error
+
+	// EmitEnvelope sends an event built beforehand, such as
+	// the ones relayed from an outbox, keeping its id.
+	EmitEnvelope(ctx context.Context, envelope Envelope) error
 }
 
 type emitter struct {
-	Emitter bus.Emitter
-	Topic   string
+	publisher publisher
+	driver    string
+	source    string
+	Topic     string
 }
 
-// NewEmitter creates a valid emitter thrrough nsq.
-func NewEmitter(ctx context.Context, conf configuration.Emission,
-	logger logging.Logger) (Emitter, error) {
-	emit, err := bus.NewEmitter(bus.EmitterConfig{
-		DialTimeout:        1 * time.Second,
-		ReadTimeout:        15 * time.Second,
-		WriteTimeout:       4 * time.Second,
-		MaxBackoffDuration: 30 * time.Second,
-		MsgTimeout:         10 * time.Second,
-		HeartbeatInterval:  5 * time.Second,
-
-		MaxInFlight: conf.MaxInFlight,
-		Address:     conf.Address,
-	})
+// NewEmitter creates a valid emitter through the configured backend,
+// for the events of the source service. Its spool, if any,
+// is drained until ctx is done.
+func NewEmitter(ctx context.Context, source string, conf configuration.Emission,
+	logger logging.Logger, statter stats.Statter) (Emitter, error) {
 
-	if err != nil {
-		return nil, errors.Wrapf(err,
-			"an error occured while contacting nsq with %s",
-			conf.Address)
+	var (
+		pub    publisher
+		driver = conf.Driver
+	)
+
+	switch driver {
+	case configuration.MemoryDriver:
+		pub = inProcess
+
+	case "", configuration.NSQDriver:
+		nsq, err := newNSQPublisher(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		pub, driver = nsq, configuration.NSQDriver
+
+		if conf.Spool.Directory != "" {
+			nsq.wait = true
+
+			spool, err := newSpool(nsq, conf.Spool, logger, statter)
+			if err != nil {
+				return nil, err
+			}
+
+			go spool.Run(ctx)
+			pub = spool
+		}
+
+	default:
+		return nil, errors.Errorf("unknown messaging driver: %s", conf.Driver)
 	}
 
-	logger.Info("nsq emitter was created")
+	logger.Infof("%s emitter was created", driver)
 
 	return &emitter{
-		Emitter: *emit,
-		Topic:   conf.Topic,
+		publisher: pub,
+		driver:    driver,
+		source:    source,
+		Topic:     conf.Topic,
 	}, nil
 }
 
-func (e *emitter) Emit(_ context.Context, payload interface{}) error {
-	return e.Emitter.EmitAsync(e.Topic, payload)
+// Emit sends payload in the envelope of an event of the current version of its type,
+// correlated with the request and trace of ctx.
+func (e *emitter) Emit(ctx context.Context, event EventType, payload interface{}) error {
+	envelope, err := NewEnvelope(ctx, event, payload)
+	if err != nil {
+		return err
+	}
+
+	return e.EmitEnvelope(ctx, envelope)
+}
+
+// EmitEnvelope publishes an envelope on the topic,
+// from the source of the emitter unless it has one.
+func (e *emitter) EmitEnvelope(ctx context.Context, envelope Envelope) error {
+	ctx, span := tracing.StartSpan(ctx, "emit "+e.Topic, tracing.SpanKindProducer)
+	defer span.End()
+
+	span.SetAttribute("messaging.system", e.driver)
+	span.SetAttribute("messaging.destination", e.Topic)
+	span.SetAttribute("messaging.event_type", envelope.Type)
+
+	if envelope.Source == "" {
+		envelope.Source = e.source
+	}
+
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		span.SetError(err)
+		return errors.Wrap(err, "an error occured while encoding message")
+	}
+
+	err = e.publisher.publish(ctx, e.Topic, body)
+	if _, known := errors.Cause(err).(*problem.Error); err != nil && !known && ctx.Err() == nil {
+		err = errors.Wrap(ErrBrokerUnavailable, err.Error())
+	}
+
+	span.SetError(err)
+
+	return err
 }
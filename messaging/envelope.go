@@ -0,0 +1,149 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/entropy"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/tracing"
+)
+
+// Envelope wraps the payload of an event with what describes it,
+// so that consumers pick the handler of its type and version.
+type Envelope struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	Source     string    `json:"source"`
+	OccurredAt time.Time `json:"occurred_at"`
+
+	// CorrelationID is the id of the request emitting the event,
+	// and Trace propagates its trace context.
+	CorrelationID string             `json:"correlation_id,omitempty"`
+	Trace         tracing.MapCarrier `json:"trace,omitempty"`
+
+	Payload json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope wraps payload in an event of the current version of its type,
+// correlated with the request and trace of ctx. Its source is left
+// to the emitter sending it.
+func NewEnvelope(ctx context.Context, event EventType, payload interface{}) (Envelope, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, errors.Wrap(err, "an error occured while encoding event payload")
+	}
+
+	envelope := Envelope{
+		ID:         entropy.FromContext(ctx).NewID(),
+		Type:       event.Name,
+		Version:    event.Version,
+		OccurredAt: time.Now().UTC(),
+
+		CorrelationID: logging.RequestIDFromContext(ctx),
+		Trace:         tracing.MapCarrier{},
+
+		Payload: raw,
+	}
+
+	tracing.Inject(ctx, envelope.Trace)
+
+	return envelope, nil
+}
+
+// Decode unmarshals the payload of the event into v.
+func (e Envelope) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// EventType describes the schema of a type of event.
+// Consumers handle its versions from MinVersion to Version,
+// the versions before MinVersion being no longer compatible.
+type EventType struct {
+	Name       string
+	Version    int
+	MinVersion int
+}
+
+// The catalog of the events, named after the entity they are about.
+// Trip events carry a models.Trip without its locations, bike events a models.Bike,
+// and TripLocationTracked the location of a trip sent to the gateway.
+var (
+	TripLocationTracked = RegisterEvent("trip.location_tracked", 1, 1)
+	TripStarted         = RegisterEvent("trip.started", 1, 1)
+	TripEnded           = RegisterEvent("trip.ended", 1, 1)
+	BikeLocked          = RegisterEvent("bike.locked", 1, 1)
+	BikeUnlocked        = RegisterEvent("bike.unlocked", 1, 1)
+)
+
+// Errors of the messages which are not events of the catalog.
+var (
+	ErrMalformedEvent = errors.New("message is not an event")
+	ErrUnknownEvent   = errors.New("unknown event type")
+	ErrRetiredVersion = errors.New("event version is no longer supported")
+	ErrNewerVersion   = errors.New("event version is not supported yet")
+)
+
+var (
+	mutex   sync.RWMutex
+	catalog = map[string]EventType{}
+)
+
+// RegisterEvent adds a type of event to the catalog.
+func RegisterEvent(name string, version, minVersion int) EventType {
+	event := EventType{
+		Name:       name,
+		Version:    version,
+		MinVersion: minVersion,
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	catalog[name] = event
+	return event
+}
+
+// LookupEvent returns the type of event registered for name.
+func LookupEvent(name string) (EventType, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	event, ok := catalog[name]
+	return event, ok
+}
+
+// Open decodes the envelope of a message,
+// checking its type and version against the catalog.
+func (m *Message) Open() (Envelope, error) {
+	envelope := Envelope{}
+
+	err := m.Decode(&envelope)
+	if err != nil {
+		return envelope, errors.Wrap(ErrMalformedEvent, err.Error())
+	}
+
+	if envelope.Type == "" || len(envelope.Payload) == 0 {
+		return envelope, ErrMalformedEvent
+	}
+
+	event, ok := LookupEvent(envelope.Type)
+	if !ok {
+		return envelope, errors.Wrap(ErrUnknownEvent, envelope.Type)
+	}
+
+	if envelope.Version < event.MinVersion {
+		return envelope, errors.Wrapf(ErrRetiredVersion, "%s v%d", envelope.Type, envelope.Version)
+	}
+
+	if envelope.Version > event.Version {
+		return envelope, errors.Wrapf(ErrNewerVersion, "%s v%d", envelope.Type, envelope.Version)
+	}
+
+	return envelope, nil
+}
@@ -0,0 +1,185 @@
+package messaging
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bounds of the in-memory bus.
+const (
+	// memoryQueueSize bounds the messages waiting for a subscription,
+	// and for a topic without subscriptions, which keeps the latest ones.
+	memoryQueueSize = 1024
+
+	// memoryRequeueDelay is the delay of a requeue
+	// left to the backend, by attempt.
+	memoryRequeueDelay = time.Second
+)
+
+// inProcess is the bus shared by the services of a process.
+var inProcess = &memoryBus{
+	topics: map[string]*memoryTopic{},
+}
+
+// memoryBus delivers messages through channels: every channel
+// of a topic receives all of its messages, shared by its subscriptions.
+// Channels are kept once created, publishing blocking
+// while the queue of one of them is full.
+type memoryBus struct {
+	mutex  sync.Mutex
+	topics map[string]*memoryTopic
+	ids    uint64
+}
+
+type memoryTopic struct {
+	channels map[string]*memoryChannel
+
+	// backlog keeps the messages published before
+	// the first channel of the topic.
+	backlog []memoryMessage
+}
+
+type memoryMessage struct {
+	id        string
+	body      []byte
+	attempts  int
+	timestamp time.Time
+}
+
+type memoryChannel struct {
+	queue chan memoryMessage
+}
+
+func (e *memoryBus) topic(name string) *memoryTopic {
+	topic, ok := e.topics[name]
+	if !ok {
+		topic = &memoryTopic{
+			channels: map[string]*memoryChannel{},
+		}
+
+		e.topics[name] = topic
+	}
+
+	return topic
+}
+
+// channel returns the channel of a topic, created
+// with the backlog of the topic when it is the first one.
+func (e *memoryTopic) channel(name string) *memoryChannel {
+	channel, ok := e.channels[name]
+	if !ok {
+		channel = &memoryChannel{
+			queue: make(chan memoryMessage, memoryQueueSize),
+		}
+
+		for _, message := range e.backlog {
+			channel.queue <- message
+		}
+
+		e.backlog = nil
+		e.channels[name] = channel
+	}
+
+	return channel
+}
+
+func (e *memoryBus) publish(ctx context.Context, topic string, body []byte) error {
+	message := memoryMessage{
+		id:        strconv.FormatUint(atomic.AddUint64(&e.ids, 1), 10),
+		body:      body,
+		attempts:  1,
+		timestamp: time.Now(),
+	}
+
+	e.mutex.Lock()
+	t := e.topic(topic)
+	if len(t.channels) == 0 {
+		if len(t.backlog) == memoryQueueSize {
+			t.backlog = t.backlog[1:]
+		}
+
+		t.backlog = append(t.backlog, message)
+		e.mutex.Unlock()
+		return nil
+	}
+
+	channels := make([]*memoryChannel, 0, len(t.channels))
+	for _, channel := range t.channels {
+		channels = append(channels, channel)
+	}
+	e.mutex.Unlock()
+
+	for _, channel := range channels {
+		select {
+		case channel.queue <- message:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (e *memoryBus) subscribe(ctx context.Context, topic, channel string,
+	maxInFlight int, deliver func(*Message)) error {
+
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+
+	e.mutex.Lock()
+	c := e.topic(topic).channel(channel)
+	e.mutex.Unlock()
+
+	inFlight := make(chan struct{}, maxInFlight)
+	for {
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		select {
+		case message := <-c.queue:
+			deliver(c.message(ctx, topic, message, inFlight))
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// message hands over a message, freeing its slot
+// in flight once it is answered.
+func (e *memoryChannel) message(ctx context.Context, topic string,
+	message memoryMessage, inFlight chan struct{}) *Message {
+
+	return &Message{
+		ID:        message.id,
+		Topic:     topic,
+		Body:      message.body,
+		Attempts:  message.attempts,
+		Timestamp: message.timestamp,
+
+		ack: func() {
+			<-inFlight
+		},
+		requeue: func(delay time.Duration) {
+			<-inFlight
+
+			if delay < 0 {
+				delay = time.Duration(message.attempts) * memoryRequeueDelay
+			}
+
+			message.attempts++
+			time.AfterFunc(delay, func() {
+				select {
+				case e.queue <- message:
+				case <-ctx.Done():
+				}
+			})
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a message received from a messaging backend.
+// It is answered once, either acknowledged, requeued or rejected.
+type Message struct {
+	ID        string
+	Topic     string
+	Body      []byte
+	Attempts  int
+	Timestamp time.Time
+
+	ack       func()
+	requeue   func(delay time.Duration)
+	reject    func(reason error)
+	responded int32
+}
+
+// Decode unmarshals the json body of the message into v.
+func (m *Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Body, v)
+}
+
+// Ack tells the backend the message is handled,
+// so that it is not delivered again.
+func (m *Message) Ack() {
+	if m.answer() {
+		m.ack()
+	}
+}
+
+// Requeue delivers the message again after delay.
+// A negative delay lets the backend pick one.
+func (m *Message) Requeue(delay time.Duration) {
+	if m.answer() {
+		m.requeue(delay)
+	}
+}
+
+// Reject gives up on a message which would never be handled,
+// sending it to the dead letter topic along with reason.
+func (m *Message) Reject(reason error) {
+	if m.answer() {
+		m.reject(reason)
+	}
+}
+
+// answered reports whether the message was answered.
+func (m *Message) answered() bool {
+	return atomic.LoadInt32(&m.responded) == 1
+}
+
+// answer reports whether the message is still to be answered,
+// marking it as answered.
+func (m *Message) answer() bool {
+	return atomic.CompareAndSwapInt32(&m.responded, 0, 1)
+}
+
+// Handler handles a message, which is acknowledged when it succeeds,
+// and otherwise requeued until its last attempt sends it
+// to the dead letter topic.
+type Handler func(ctx context.Context, message *Message) error
+
+// publisher sends message bodies through a backend.
+type publisher interface {
+	publish(ctx context.Context, topic string, body []byte) error
+}
+
+// subscriber delivers the messages of a topic to a channel until ctx is done,
+// with at most maxInFlight of them unanswered at once.
+type subscriber interface {
+	subscribe(ctx context.Context, topic, channel string,
+		maxInFlight int, deliver func(*Message)) error
+}
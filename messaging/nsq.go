@@ -0,0 +1,144 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	nsq "github.com/nsqio/go-nsq"
+	"github.com/pkg/errors"
+	bus "github.com/rafaeljesus/nsq-event-bus"
+
+	"github.com/EarvinKayonga/rider/configuration"
+)
+
+// nsqStopTimeout bounds the wait for a consumer to stop,
+// its unanswered messages being delivered again by nsqd.
+const nsqStopTimeout = 30 * time.Second
+
+// nsqPublisher publishes through nsqd.
+type nsqPublisher struct {
+	emitter *bus.Emitter
+
+	// wait makes publish wait for nsqd
+	// to acknowledge the message.
+	wait bool
+}
+
+func newNSQPublisher(conf configuration.Emission) (*nsqPublisher, error) {
+	emit, err := bus.NewEmitter(bus.EmitterConfig{
+		DialTimeout:        1 * time.Second,
+		ReadTimeout:        15 * time.Second,
+		WriteTimeout:       4 * time.Second,
+		MaxBackoffDuration: 30 * time.Second,
+		MsgTimeout:         10 * time.Second,
+		HeartbeatInterval:  5 * time.Second,
+
+		MaxInFlight: conf.MaxInFlight,
+		Address:     conf.Address,
+
+		// the breaker opens once nsqd failed a few times in a row,
+		// and calls OnStateChange on every change.
+		Breaker: bus.Breaker{
+			Threshold:     5,
+			Timeout:       5 * time.Second,
+			OnStateChange: func(name, from, to string) {},
+		},
+	})
+
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while contacting nsq with %s",
+			conf.Address)
+	}
+
+	return &nsqPublisher{
+		emitter: emit,
+		wait:    conf.Acknowledged,
+	}, nil
+}
+
+// publish gives up waiting for nsqd once ctx is done,
+// the message being possibly published nonetheless.
+func (e *nsqPublisher) publish(ctx context.Context, topic string, body []byte) error {
+	if !e.wait {
+		return e.emitter.EmitAsync(topic, json.RawMessage(body))
+	}
+
+	published := make(chan error, 1)
+	go func() {
+		published <- e.emitter.Emit(topic, json.RawMessage(body))
+	}()
+
+	select {
+	case err := <-published:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nsqSubscriber subscribes through nsqlookupd.
+type nsqSubscriber struct {
+	address string
+}
+
+// subscribe consumes a topic until ctx is done, then stops the consumer,
+// waiting at most nsqStopTimeout for it to close its connections.
+func (e *nsqSubscriber) subscribe(ctx context.Context, topic, channel string,
+	maxInFlight int, deliver func(*Message)) error {
+
+	config := nsq.NewConfig()
+	config.MaxInFlight = maxInFlight
+
+	// the attempts are bounded by the consumers,
+	// which send the last ones to the dead letter topic.
+	config.MaxAttempts = math.MaxUint16
+
+	consumer, err := nsq.NewConsumer(topic, channel, config)
+	if err != nil {
+		return errors.Wrapf(err,
+			"an error occured while creating consumer of %s", topic)
+	}
+
+	consumer.AddHandler(nsq.HandlerFunc(func(message *nsq.Message) error {
+		// the body is the envelope of the bus emitter.
+		envelope := bus.Message{}
+		err := json.Unmarshal(message.Body, &envelope)
+		if err != nil {
+			return err
+		}
+
+		message.DisableAutoResponse()
+		deliver(&Message{
+			ID:        string(message.ID[:]),
+			Topic:     topic,
+			Body:      envelope.Payload,
+			Attempts:  int(message.Attempts),
+			Timestamp: time.Unix(0, message.Timestamp),
+
+			ack:     message.Finish,
+			requeue: message.Requeue,
+		})
+
+		return nil
+	}))
+
+	err = consumer.ConnectToNSQLookupd(e.address)
+	if err != nil {
+		consumer.Stop()
+		return errors.Wrapf(err,
+			"an error occured while setting consumer at %s", e.address)
+	}
+
+	<-ctx.Done()
+
+	consumer.Stop()
+	select {
+	case <-consumer.StopChan:
+		return nil
+	case <-time.After(nsqStopTimeout):
+		return errors.Errorf("consumer of %s not stopped after %s", topic, nsqStopTimeout)
+	}
+}
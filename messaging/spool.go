@@ -0,0 +1,403 @@
+package messaging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/stats"
+)
+
+// Files of a spool directory.
+const (
+	spoolFile       = "spool.jsonl"
+	spoolOffsetFile = "spool.offset"
+)
+
+// spooledMessage is a line of the spool.
+type spooledMessage struct {
+	Topic string          `json:"topic"`
+	Body  json.RawMessage `json:"body"`
+}
+
+// spool publishes through a publisher, appending the messages
+// it could not publish to a bounded write-ahead file.
+// Once a message is spooled, the following ones are too,
+// until the spool is drained in order.
+type spool struct {
+	publisher publisher
+	conf      configuration.Spool
+	logger    logging.Logger
+	statter   stats.Statter
+
+	mutex sync.Mutex
+	file  *os.File
+
+	// size is the length of the file, of which offset
+	// is already published, leaving depth messages.
+	size   int64
+	offset int64
+	depth  int64
+}
+
+// newSpool opens the spool of a directory, resuming after
+// its last published message. A line torn by a crash is dropped.
+func newSpool(pub publisher, conf configuration.Spool,
+	logger logging.Logger, statter stats.Statter) (*spool, error) {
+
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = configuration.DefaultSpool.MaxSize
+	}
+
+	if conf.DrainInterval <= 0 {
+		conf.DrainInterval = configuration.DefaultSpool.DrainInterval
+	}
+
+	err := os.MkdirAll(conf.Directory, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while creating spool directory: %s", conf.Directory)
+	}
+
+	e := &spool{
+		publisher: pub,
+		conf:      conf,
+		logger:    logger,
+		statter:   statter,
+	}
+
+	e.file, err = os.OpenFile(filepath.Join(conf.Directory, spoolFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while opening spool in %s", conf.Directory)
+	}
+
+	err = e.recover()
+	if err != nil {
+		_ = e.file.Close()
+		return nil, err
+	}
+
+	e.gauge()
+	return e, nil
+}
+
+// recover reads the offset of the spool, and counts
+// the complete lines following it.
+func (e *spool) recover() error {
+	content, err := ioutil.ReadFile(filepath.Join(e.conf.Directory, spoolOffsetFile))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "an error occured while reading spool offset")
+	}
+
+	if len(content) > 0 {
+		e.offset, err = strconv.ParseInt(string(bytes.TrimSpace(content)), 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while parsing spool offset")
+		}
+	}
+
+	info, err := e.file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "an error occured while reading spool")
+	}
+
+	// the spool was emptied before its offset was reset.
+	if e.offset > info.Size() {
+		e.offset = 0
+	}
+
+	_, err = e.file.Seek(e.offset, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while seeking spool")
+	}
+
+	e.size = e.offset
+	reader := bufio.NewReader(e.file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "an error occured while reading spool")
+		}
+
+		e.size += int64(len(line))
+		e.depth++
+	}
+
+	err = e.file.Truncate(e.size)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while truncating spool")
+	}
+
+	return nil
+}
+
+// publish publishes a message unless the spool holds messages,
+// spooling it as well when the broker does not acknowledge it.
+// A message is not spooled when ctx is done, as it may be published.
+// The lock is only held to spool, so that publishes do not wait on each other.
+func (e *spool) publish(ctx context.Context, topic string, body []byte) error {
+	e.mutex.Lock()
+	if e.depth > 0 {
+		defer e.mutex.Unlock()
+		return e.append(topic, body)
+	}
+	e.mutex.Unlock()
+
+	err := e.publisher.publish(ctx, topic, body)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	e.logger.
+		WithError(err).
+		Warnf("an error occured while publishing to %s, spooling messages", topic)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.append(topic, body)
+}
+
+// append writes a message at the end of the spool,
+// the lock being held.
+func (e *spool) append(topic string, body []byte) error {
+	line, err := json.Marshal(spooledMessage{
+		Topic: topic,
+		Body:  body,
+	})
+	if err != nil {
+		return errors.Wrap(err, "an error occured while encoding spooled message")
+	}
+
+	line = append(line, '\n')
+
+	if e.size+int64(len(line)) > e.conf.MaxSize && e.offset > 0 {
+		err = e.compact()
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.size+int64(len(line)) > e.conf.MaxSize {
+		return ErrSpoolFull
+	}
+
+	_, err = e.file.WriteAt(line, e.size)
+	if err == nil {
+		err = e.file.Sync()
+	}
+
+	if err != nil {
+		// a torn line is overwritten by the next one.
+		return errors.Wrap(err, "an error occured while writing to spool")
+	}
+
+	e.size += int64(len(line))
+	e.depth++
+	e.gauge()
+
+	return nil
+}
+
+// Run drains the spool every DrainInterval until ctx is done.
+func (e *spool) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.conf.DrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := e.drain(ctx)
+			if err != nil {
+				e.logger.WithError(err).Warn("an error occured while draining spool")
+			}
+
+		case <-ctx.Done():
+			e.mutex.Lock()
+			defer e.mutex.Unlock()
+
+			err := e.file.Close()
+			if err != nil {
+				e.logger.WithError(err).Warn("an error occured while closing spool")
+			}
+
+			return
+		}
+	}
+}
+
+// drain publishes the spooled messages in order, stopping at the first failure.
+// The spool is emptied once they are all published.
+func (e *spool) drain(ctx context.Context) error {
+	drained := false
+	for {
+		line, err := e.next()
+		if err != nil {
+			return err
+		}
+
+		if line == nil {
+			break
+		}
+
+		message := spooledMessage{}
+		err = json.Unmarshal(line, &message)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while decoding spooled message")
+		}
+
+		err = e.publisher.publish(ctx, message.Topic, message.Body)
+		if err != nil {
+			return errors.Wrapf(err, "an error occured while publishing spooled message to %s", message.Topic)
+		}
+
+		err = e.advance(int64(len(line)))
+		if err != nil {
+			return err
+		}
+
+		drained = true
+	}
+
+	if drained {
+		e.logger.Info("spool drained")
+	}
+
+	return nil
+}
+
+// next reads the first unpublished message of the spool, if any.
+func (e *spool) next() ([]byte, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.offset == e.size {
+		return nil, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(e.file, e.offset, e.size-e.offset))
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, errors.Wrapf(err, "an error occured while reading spool at %d", e.offset)
+	}
+
+	return line, nil
+}
+
+// advance records that the first n bytes of the unpublished messages
+// are published, emptying the spool when it is all published
+// and compacting it when most of it is.
+func (e *spool) advance(n int64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.offset += n
+	e.depth--
+	e.gauge()
+
+	switch {
+	case e.offset == e.size:
+		err := e.file.Truncate(0)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while truncating spool")
+		}
+
+		e.offset, e.size = 0, 0
+
+	case e.offset >= e.conf.MaxSize/2:
+		return e.compact()
+	}
+
+	return e.writeOffset()
+}
+
+// compact rewrites the unpublished messages at the start of the spool,
+// the lock being held. The offset is reset before the spool is replaced:
+// a crash in between publishes the messages already published again,
+// rather than skipping unpublished ones.
+func (e *spool) compact() error {
+	path := filepath.Join(e.conf.Directory, spoolFile)
+
+	compacted, err := os.OpenFile(path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while compacting spool")
+	}
+
+	_, err = io.Copy(compacted, io.NewSectionReader(e.file, e.offset, e.size-e.offset))
+	if err == nil {
+		err = compacted.Sync()
+	}
+
+	if err != nil {
+		_ = compacted.Close()
+		return errors.Wrap(err, "an error occured while compacting spool")
+	}
+
+	offset := e.offset
+	e.offset = 0
+
+	err = e.writeOffset()
+	if err != nil {
+		e.offset = offset
+		_ = compacted.Close()
+		return err
+	}
+
+	err = os.Rename(path+".compact", path)
+	if err != nil {
+		_ = compacted.Close()
+
+		e.offset = offset
+		thr := e.writeOffset()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("an error occured while restoring spool offset")
+		}
+
+		return errors.Wrap(err, "an error occured while replacing compacted spool")
+	}
+
+	err = e.file.Close()
+	if err != nil {
+		e.logger.WithError(err).Warn("an error occured while closing compacted spool")
+	}
+
+	e.file = compacted
+	e.size -= offset
+
+	return nil
+}
+
+// writeOffset persists the offset of the spool,
+// the lock being held.
+func (e *spool) writeOffset() error {
+	err := ioutil.WriteFile(filepath.Join(e.conf.Directory, spoolOffsetFile),
+		[]byte(strconv.FormatInt(e.offset, 10)), 0600)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while writing spool offset")
+	}
+
+	return nil
+}
+
+// gauge reports the depth of the spool,
+// the lock being held.
+func (e *spool) gauge() {
+	_ = e.statter.Gauge("messaging.spool.depth", e.depth, 1.0)
+}
@@ -0,0 +1,359 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/stats"
+)
+
+// fakePublisher records the messages it publishes,
+// failing once it has published accept of them.
+type fakePublisher struct {
+	mutex  sync.Mutex
+	accept int
+	bodies []string
+}
+
+func (e *fakePublisher) publish(ctx context.Context, topic string, body []byte) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(e.bodies) >= e.accept {
+		return errors.New("broker unreachable")
+	}
+
+	e.bodies = append(e.bodies, string(body))
+	return nil
+}
+
+func (e *fakePublisher) published() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return append([]string{}, e.bodies...)
+}
+
+func (e *fakePublisher) setAccept(accept int) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.accept = accept
+}
+
+// blockingPublisher publishes the messages of topic "slow"
+// once released, telling when it blocks.
+type blockingPublisher struct {
+	fakePublisher
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (e *blockingPublisher) publish(ctx context.Context, topic string, body []byte) error {
+	if topic == "slow" {
+		close(e.blocked)
+		<-e.release
+	}
+
+	return e.fakePublisher.publish(ctx, topic, body)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func openSpool(t *testing.T, pub publisher, dir string, maxSize int64) *spool {
+	e, err := newSpool(pub, configuration.Spool{Directory: dir, MaxSize: maxSize},
+		*logging.NewLogger(configuration.Logging{Level: "error"}), stats.Mock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+// message returns the body of the i-th message.
+func message(i int) []byte {
+	return []byte(fmt.Sprintf(`{"n":%d}`, i))
+}
+
+func messages(from, to int) []string {
+	bodies := []string{}
+	for i := from; i < to; i++ {
+		bodies = append(bodies, string(message(i)))
+	}
+
+	return bodies
+}
+
+func publishMessages(t *testing.T, e *spool, from, to int) {
+	for i := from; i < to; i++ {
+		err := e.publish(context.Background(), "events", message(i))
+		if err != nil {
+			t.Fatalf("expected message %d to be published or spooled, got %v", i, err)
+		}
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return info.Size()
+}
+
+func TestSpoolDrainOrder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &fakePublisher{accept: 2}
+	e := openSpool(t, pub, dir, 1<<20)
+	defer e.file.Close()
+
+	publishMessages(t, e, 0, 5)
+	if e.depth != 3 {
+		t.Fatalf("expected 3 spooled messages, got %d", e.depth)
+	}
+
+	// the broker is back, but the spool is published first.
+	pub.setAccept(100)
+	publishMessages(t, e, 5, 6)
+	if e.depth != 4 {
+		t.Fatalf("expected 4 spooled messages, got %d", e.depth)
+	}
+
+	err := e.drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pub.published(); !reflect.DeepEqual(got, messages(0, 6)) {
+		t.Fatalf("expected messages in order, got %v", got)
+	}
+
+	if e.depth != 0 || fileSize(t, filepath.Join(dir, spoolFile)) != 0 {
+		t.Fatalf("expected an empty spool, got %d messages", e.depth)
+	}
+}
+
+func TestSpoolOffset(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &fakePublisher{}
+	e := openSpool(t, pub, dir, 1<<20)
+	defer e.file.Close()
+
+	publishMessages(t, e, 0, 3)
+
+	pub.setAccept(1)
+	err := e.drain(context.Background())
+	if err == nil {
+		t.Fatal("expected the drain to stop at the unpublished message")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, spoolOffsetFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := e.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != strconv.FormatInt(e.offset, 10) || e.offset == 0 {
+		t.Fatalf("expected offset %d to be persisted, got %s", e.offset, content)
+	}
+
+	if string(line) != `{"topic":"events","body":{"n":1}}`+"\n" {
+		t.Fatalf("expected the second message to be next, got %s", line)
+	}
+}
+
+func TestSpoolRecovery(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &fakePublisher{}
+	e := openSpool(t, pub, dir, 1<<20)
+
+	publishMessages(t, e, 0, 4)
+
+	pub.setAccept(2)
+	_ = e.drain(context.Background())
+	_ = e.file.Close()
+
+	// the spool resumes after the messages published before the restart.
+	e = openSpool(t, pub, dir, 1<<20)
+	defer e.file.Close()
+
+	if e.depth != 2 {
+		t.Fatalf("expected 2 spooled messages, got %d", e.depth)
+	}
+
+	pub.setAccept(100)
+	err := e.drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pub.published(); !reflect.DeepEqual(got, messages(0, 4)) {
+		t.Fatalf("expected each message once and in order, got %v", got)
+	}
+}
+
+func TestSpoolTornLine(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &fakePublisher{}
+	e := openSpool(t, pub, dir, 1<<20)
+
+	publishMessages(t, e, 0, 2)
+	size := e.size
+
+	// a crash in the middle of a write.
+	_, err := e.file.WriteAt([]byte(`{"topic":"events","bo`), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = e.file.Close()
+
+	e = openSpool(t, pub, dir, 1<<20)
+	defer e.file.Close()
+
+	if e.depth != 2 || e.size != size || fileSize(t, filepath.Join(dir, spoolFile)) != size {
+		t.Fatalf("expected the torn line to be dropped, got %d messages in %d bytes", e.depth, e.size)
+	}
+
+	publishMessages(t, e, 2, 3)
+
+	pub.setAccept(100)
+	err = e.drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pub.published(); !reflect.DeepEqual(got, messages(0, 3)) {
+		t.Fatalf("expected the complete messages in order, got %v", got)
+	}
+}
+
+func TestSpoolFull(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// each message takes 34 bytes.
+	pub := &fakePublisher{}
+	e := openSpool(t, pub, dir, 100)
+	defer e.file.Close()
+
+	publishMessages(t, e, 0, 2)
+
+	err := e.publish(context.Background(), "events", message(2))
+	if err != ErrSpoolFull {
+		t.Fatalf("expected %v, got %v", ErrSpoolFull, err)
+	}
+
+	if e.depth != 2 {
+		t.Fatalf("expected 2 spooled messages, got %d", e.depth)
+	}
+}
+
+func TestSpoolCompaction(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &fakePublisher{}
+	e := openSpool(t, pub, dir, 600)
+	defer e.file.Close()
+
+	// the spool is never emptied, yet its file stays bounded.
+	accepted := 0
+	for i := 0; i < 50; i += 5 {
+		publishMessages(t, e, i, i+5)
+
+		accepted += 4
+		pub.setAccept(accepted)
+		_ = e.drain(context.Background())
+
+		if size := fileSize(t, filepath.Join(dir, spoolFile)); size > 600 {
+			t.Fatalf("expected the spool to be compacted, got %d bytes", size)
+		}
+	}
+
+	pub.setAccept(100)
+	err := e.drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := pub.published(); !reflect.DeepEqual(got, messages(0, 50)) {
+		t.Fatalf("expected each message once and in order, got %v", got)
+	}
+}
+
+func TestSpoolConcurrentPublish(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pub := &blockingPublisher{
+		fakePublisher: fakePublisher{accept: 100},
+		blocked:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	e := openSpool(t, pub, dir, 1<<20)
+	defer e.file.Close()
+
+	slow := make(chan error)
+	go func() {
+		slow <- e.publish(context.Background(), "slow", message(0))
+	}()
+	<-pub.blocked
+
+	// a message is published while the broker is slow to answer another.
+	published := make(chan error)
+	go func() {
+		published <- e.publish(context.Background(), "events", message(1))
+	}()
+
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fatal(err)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("expected the publish not to wait for the slow one")
+	}
+
+	close(pub.release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{string(message(1)), string(message(0))}
+	if got := pub.published(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected both messages to be published, got %v", got)
+	}
+}
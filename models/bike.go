@@ -1,8 +1,137 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // Bike model.
 type Bike struct {
-	ID       string   `json:"id"`
-	Status   int      `json:"status"`
-	Location Location `json:"location"`
+	ID       string     `json:"id"`
+	Status   BikeStatus `json:"status"`
+	Location Location   `json:"location"`
+}
+
+// NearbyBike is a bike along with its distance,
+// in meters, to a searched location.
+type NearbyBike struct {
+	Bike
+
+	Distance float64 `json:"distance"`
+}
+
+// BikeStatus is the state of a bike in the fleet.
+type BikeStatus int
+
+// Bike statuses.
+// Their values are the ones persisted,
+// in_use and available keep the former 0 and 1.
+const (
+	BikeInUse BikeStatus = iota
+	BikeAvailable
+	BikeReserved
+	BikeMaintenance
+	BikeLost
+	BikeRetired
+)
+
+var bikeStatusNames = map[BikeStatus]string{
+	BikeInUse:       "in_use",
+	BikeAvailable:   "available",
+	BikeReserved:    "reserved",
+	BikeMaintenance: "maintenance",
+	BikeLost:        "lost",
+	BikeRetired:     "retired",
+}
+
+// bikeTransitions lists for each status
+// the statuses a bike may move to.
+var bikeTransitions = map[BikeStatus][]BikeStatus{
+	BikeAvailable:   {BikeInUse, BikeReserved, BikeMaintenance, BikeLost, BikeRetired},
+	BikeReserved:    {BikeInUse, BikeAvailable},
+	BikeInUse:       {BikeAvailable, BikeLost},
+	BikeMaintenance: {BikeAvailable, BikeRetired},
+	BikeLost:        {BikeMaintenance, BikeRetired},
+	BikeRetired:     {},
+}
+
+// ParseBikeStatus returns the status named s.
+func ParseBikeStatus(s string) (BikeStatus, bool) {
+	for status, name := range bikeStatusNames {
+		if name == s {
+			return status, true
+		}
+	}
+
+	return 0, false
+}
+
+// String for Stringer interface.
+func (s BikeStatus) String() string {
+	name, ok := bikeStatusNames[s]
+	if !ok {
+		return "unknown"
+	}
+
+	return name
+}
+
+// Valid tells whether s is a known status.
+func (s BikeStatus) Valid() bool {
+	_, ok := bikeStatusNames[s]
+	return ok
+}
+
+// CanTransitionTo tells whether a bike may move from s to status.
+func (s BikeStatus) CanTransitionTo(status BikeStatus) bool {
+	for _, next := range bikeTransitions[s] {
+		if next == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowedFrom returns the statuses a bike may move to status from.
+func AllowedFrom(status BikeStatus) []BikeStatus {
+	from := []BikeStatus{}
+	for _, s := range []BikeStatus{BikeInUse, BikeAvailable, BikeReserved,
+		BikeMaintenance, BikeLost, BikeRetired} {
+
+		if s.CanTransitionTo(status) {
+			from = append(from, s)
+		}
+	}
+
+	return from
+}
+
+// MarshalJSON serializes a status as its name.
+func (s BikeStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON reads a status from its name,
+// or from its former integer representation.
+func (s *BikeStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		var value int
+		if json.Unmarshal(data, &value) != nil || !BikeStatus(value).Valid() {
+			return fmt.Errorf("invalid bike status: %s", data)
+		}
+
+		*s = BikeStatus(value)
+		return nil
+	}
+
+	status, ok := ParseBikeStatus(name)
+	if !ok {
+		return fmt.Errorf("invalid bike status: %s", name)
+	}
+
+	*s = status
+	return nil
 }
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var bikeStatuses = []BikeStatus{BikeInUse, BikeAvailable, BikeReserved,
+	BikeMaintenance, BikeLost, BikeRetired}
+
+func TestBikeStatusValues(t *testing.T) {
+	// the values are persisted, and must not change.
+	tests := map[BikeStatus]int{
+		BikeInUse:       0,
+		BikeAvailable:   1,
+		BikeReserved:    2,
+		BikeMaintenance: 3,
+		BikeLost:        4,
+		BikeRetired:     5,
+	}
+
+	for status, value := range tests {
+		if int(status) != value {
+			t.Fatalf("expected %s to be persisted as %d, got %d", status, value, int(status))
+		}
+	}
+}
+
+func TestCanTransitionTo(t *testing.T) {
+	// the transitions allowed, any other being forbidden.
+	allowed := map[BikeStatus][]BikeStatus{
+		BikeAvailable:   {BikeInUse, BikeReserved, BikeMaintenance, BikeLost, BikeRetired},
+		BikeReserved:    {BikeInUse, BikeAvailable},
+		BikeInUse:       {BikeAvailable, BikeLost},
+		BikeMaintenance: {BikeAvailable, BikeRetired},
+		BikeLost:        {BikeMaintenance, BikeRetired},
+		BikeRetired:     {},
+	}
+
+	for _, from := range bikeStatuses {
+		for _, to := range bikeStatuses {
+			expected := false
+			for _, next := range allowed[from] {
+				expected = expected || next == to
+			}
+
+			if got := from.CanTransitionTo(to); got != expected {
+				t.Errorf("expected transition from %s to %s to be allowed: %t, got %t",
+					from, to, expected, got)
+			}
+		}
+	}
+
+	if BikeAvailable.CanTransitionTo(BikeStatus(42)) || BikeStatus(42).CanTransitionTo(BikeAvailable) {
+		t.Error("expected no transition with an unknown status")
+	}
+}
+
+func TestAllowedFrom(t *testing.T) {
+	tests := []struct {
+		status BikeStatus
+		from   []BikeStatus
+	}{
+		{status: BikeInUse, from: []BikeStatus{BikeAvailable, BikeReserved}},
+		{status: BikeAvailable, from: []BikeStatus{BikeInUse, BikeReserved, BikeMaintenance}},
+		{status: BikeReserved, from: []BikeStatus{BikeAvailable}},
+		{status: BikeMaintenance, from: []BikeStatus{BikeAvailable, BikeLost}},
+		{status: BikeLost, from: []BikeStatus{BikeInUse, BikeAvailable}},
+		{status: BikeRetired, from: []BikeStatus{BikeAvailable, BikeMaintenance, BikeLost}},
+		{status: BikeStatus(42), from: []BikeStatus{}},
+	}
+
+	for _, test := range tests {
+		if got := AllowedFrom(test.status); !reflect.DeepEqual(got, test.from) {
+			t.Errorf("expected %s to be allowed from %v, got %v", test.status, test.from, got)
+		}
+	}
+}
+
+func TestBikeStatusUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		status BikeStatus
+		valid  bool
+	}{
+		{name: "name", data: `"maintenance"`, status: BikeMaintenance, valid: true},
+		{name: "in use name", data: `"in_use"`, status: BikeInUse, valid: true},
+		{name: "legacy in use", data: `0`, status: BikeInUse, valid: true},
+		{name: "legacy available", data: `1`, status: BikeAvailable, valid: true},
+		{name: "integer", data: `5`, status: BikeRetired, valid: true},
+		{name: "unknown name", data: `"flying"`},
+		{name: "unknown integer", data: `42`},
+		{name: "negative integer", data: `-1`},
+		{name: "float", data: `1.5`},
+		{name: "boolean", data: `true`},
+		{name: "null", data: `null`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := BikeStatus(-1)
+			err := json.Unmarshal([]byte(test.data), &status)
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("expected %s to be rejected, got %s", test.data, status)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected %s to be read, got %v", test.data, err)
+			}
+
+			if status != test.status {
+				t.Fatalf("expected %s, got %s", test.status, status)
+			}
+		})
+	}
+}
+
+func TestBikeStatusMarshalJSON(t *testing.T) {
+	for _, status := range bikeStatuses {
+		data, err := json.Marshal(status)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read := BikeStatus(-1)
+		err = json.Unmarshal(data, &read)
+		if err != nil || read != status {
+			t.Fatalf("expected %s to be read back from %s, got %s, %v", status, data, read, err)
+		}
+	}
+}
@@ -1,9 +1,18 @@
 package models
 
+import (
+	"time"
+)
+
 // Location model.
 type Location struct {
 	Type        string    `json:"type"`
 	Coordinates []float64 `json:"coordinates"`
+
+	// RecordedAt is the device time of a tracked location,
+	// ReceivedAt the time the server received it.
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
 }
 
 // CreateLocation creates a location from given latitude and longitude.
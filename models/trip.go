@@ -6,10 +6,25 @@ import (
 
 // Trip model.
 type Trip struct {
-	ID        string     `json:"id"`
-	Status    int        `json:"status"`
-	BikeID    string     `json:"bike_id"`
-	Locations []Location `json:"locations"`
-	StartedAt time.Time  `json:"started_at"`
-	EndedAt   *time.Time `json:"ended_at"`
+	ID        string       `json:"id"`
+	Status    int          `json:"status"`
+	BikeID    string       `json:"bike_id"`
+	RiderID   string       `json:"rider_id,omitempty"`
+	Locations []Location   `json:"locations"`
+	StartedAt time.Time    `json:"started_at"`
+	EndedAt   *time.Time   `json:"ended_at"`
+	Summary   *TripSummary `json:"summary,omitempty"`
+}
+
+// TripSummary holds the metrics of an ended trip.
+type TripSummary struct {
+	// Distance in meters.
+	Distance float64 `json:"distance"`
+
+	// Duration in seconds.
+	Duration float64 `json:"duration"`
+
+	// Speeds in meters per second.
+	AverageSpeed float64 `json:"average_speed"`
+	MaxSpeed     float64 `json:"max_speed"`
 }
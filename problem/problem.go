@@ -0,0 +1,181 @@
+// Package problem describes the errors crossing the services,
+// rendered as RFC 7807 problem details and read back by their code.
+package problem
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// ContentType of the problem details.
+const ContentType = "application/problem+json"
+
+// typePrefix prefixes the code of an error in the type of its problem.
+const typePrefix = "urn:rider:error:"
+
+// maxProblemSize bounds the problem details read from a response.
+const maxProblemSize = 1 << 16
+
+// unknownCode is the code of the problems without one.
+const unknownCode = "unknown"
+
+// Error is an error known across the services, identified by its code.
+type Error struct {
+	Code   string
+	Status int
+	Title  string
+
+	// Detail explains this occurrence of the error,
+	// and Fields lists the invalid fields of the request.
+	Detail string
+	Fields []InvalidField
+}
+
+// InvalidField is a field of a request and why it is invalid.
+type InvalidField struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	message := e.Title
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+
+	for i, field := range e.Fields {
+		if i == 0 {
+			message += ": "
+		} else {
+			message += ", "
+		}
+
+		message += field.Name + " " + field.Reason
+	}
+
+	return message
+}
+
+// WithDetail returns a copy of the error explaining its occurrence.
+func (e *Error) WithDetail(detail string) *Error {
+	occurrence := *e
+	occurrence.Detail = detail
+
+	return &occurrence
+}
+
+// WithFields returns a copy of the error listing the invalid fields.
+func (e *Error) WithFields(fields []InvalidField) *Error {
+	occurrence := *e
+	occurrence.Fields = fields
+
+	return &occurrence
+}
+
+var (
+	mutex    sync.RWMutex
+	registry = map[string]*Error{}
+)
+
+// New returns an error known by its code, registered so that
+// the problems of other services are read back as this error.
+// It panics when the code is already registered.
+func New(code string, status int, title string) *Error {
+	err := &Error{
+		Code:   code,
+		Status: status,
+		Title:  title,
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, ok := registry[code]; ok {
+		panic("problem: error " + code + " registered twice")
+	}
+
+	registry[code] = err
+	return err
+}
+
+// Lookup returns the error registered for code.
+func Lookup(code string) (*Error, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	err, ok := registry[code]
+	return err, ok
+}
+
+// Problem is the RFC 7807 representation of an error,
+// extended with its code and the id of the request.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+
+	InvalidParams []InvalidField `json:"invalid_params,omitempty"`
+}
+
+// From returns the problem describing err.
+func From(err *Error, requestID string) Problem {
+	return Problem{
+		Type:      typePrefix + err.Code,
+		Title:     err.Title,
+		Status:    err.Status,
+		Detail:    err.Detail,
+		Code:      err.Code,
+		RequestID: requestID,
+
+		InvalidParams: err.Fields,
+	}
+}
+
+// Write renders a problem as the response.
+func Write(w http.ResponseWriter, p Problem) error {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+
+	return json.NewEncoder(w).Encode(p)
+}
+
+// Read returns the error of a failed response: the error registered
+// for the code of its problem, or else an error with its status.
+func Read(resp *http.Response) *Error {
+	p := Problem{}
+
+	if resp.Body != nil {
+		err := json.NewDecoder(io.LimitReader(resp.Body, maxProblemSize)).Decode(&p)
+		if err != nil {
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxProblemSize))
+		}
+	}
+
+	// known errors are returned as such, to be matched by identity.
+	if known, ok := Lookup(p.Code); ok {
+		return known
+	}
+
+	code, title := p.Code, p.Title
+	if code == "" {
+		code = unknownCode
+	}
+
+	if title == "" {
+		title = http.StatusText(resp.StatusCode)
+	}
+
+	return &Error{
+		Code:   code,
+		Status: resp.StatusCode,
+		Title:  title,
+		Detail: p.Detail,
+		Fields: p.InvalidParams,
+	}
+}
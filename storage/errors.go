@@ -1,9 +1,19 @@
 package storage
 
-import "github.com/pkg/errors"
+import (
+	"net/http"
+
+	"github.com/EarvinKayonga/rider/problem"
+)
 
 // Database based errors.
 var (
-	ErrBikeNotFound   = errors.New("bike not found")
-	ErrNotImplemented = errors.New("not implemented")
+	ErrBikeNotFound   = problem.New("bike_not_found", http.StatusNotFound, "bike not found")
+	ErrTripNotFound   = problem.New("trip_not_found", http.StatusNotFound, "trip not found")
+	ErrNotImplemented = problem.New("not_implemented", http.StatusNotImplemented, "not implemented")
+	ErrSchemaBehind   = problem.New("schema_behind", http.StatusServiceUnavailable, "database schema is behind")
+
+	ErrIllegalTransition = problem.New("illegal_transition", http.StatusConflict, "illegal bike status transition")
+	ErrActiveTrip        = problem.New("active_trip", http.StatusConflict, "bike already has an active trip")
+	ErrTripEnded         = problem.New("trip_ended", http.StatusConflict, "trip already ended")
 )
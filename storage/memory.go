@@ -0,0 +1,555 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/entropy"
+	"github.com/EarvinKayonga/rider/geo"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/messaging"
+	"github.com/EarvinKayonga/rider/models"
+)
+
+// memoryStore implements Store
+// in memory, for local development and tests.
+type memoryStore struct {
+	mutex sync.RWMutex
+
+	// bikeIDs keeps the insertion order of bikes,
+	// as postgres would without ORDER BY.
+	bikeIDs   []string
+	bikes     map[string]Bike
+	trips     map[string]Trip
+	locations map[string][]Location
+
+	// outbox holds the events not sent yet, oldest first,
+	// relayed one relay at a time.
+	outbox     []messaging.Envelope
+	relayMutex sync.Mutex
+
+	sequence int64
+	logger   logging.Logger
+}
+
+// NewMemoryDatabase returns a valid Store
+// kept in memory.
+func NewMemoryDatabase(ctx context.Context, logger logging.Logger) (Store, error) {
+	logger.Info("succesfully created an in-memory database")
+
+	return &memoryStore{
+		bikes:     map[string]Bike{},
+		trips:     map[string]Trip{},
+		locations: map[string][]Location{},
+		logger:    logger,
+	}, nil
+}
+
+// nextID mimics a serial column.
+// The caller must hold the write lock.
+func (e *memoryStore) nextID() int64 {
+	e.sequence++
+	return e.sequence
+}
+
+func (e *memoryStore) CreateBikes(ctx context.Context, bikes []Bike) ([]models.Bike, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, b := range bikes {
+		if _, ok := e.bikes[b.PublicID]; ok {
+			return nil, errors.Errorf("a bike with id %s already exists", b.PublicID)
+		}
+	}
+
+	created := []models.Bike{}
+	for _, b := range bikes {
+		b.ID = e.nextID()
+
+		e.bikes[b.PublicID] = b
+		e.bikeIDs = append(e.bikeIDs, b.PublicID)
+
+		created = append(created, *fromBike(b))
+	}
+
+	e.logger.Infof("inserted %d bikes", len(created))
+
+	return created, nil
+}
+
+func (e *memoryStore) UpdateBikeLocation(ctx context.Context, bikeID string, lat, lng float64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	bike, ok := e.bikes[bikeID]
+	if !ok {
+		return ErrBikeNotFound
+	}
+
+	bike.Latitude = lat
+	bike.Longitude = lng
+	e.bikes[bikeID] = bike
+
+	e.logger.Infof("location of %d bikes updated", 1)
+	return nil
+}
+
+func (e *memoryStore) UpdateBikeLocations(ctx context.Context, bikes []Bike) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	count := 0
+	for _, b := range lastLocations(bikes) {
+		bike, ok := e.bikes[b.PublicID]
+		if !ok {
+			continue
+		}
+
+		bike.Latitude = b.Latitude
+		bike.Longitude = b.Longitude
+		e.bikes[b.PublicID] = bike
+		count++
+	}
+
+	e.logger.Infof("location of %d bikes updated", count)
+	return nil
+}
+
+func (e *memoryStore) FindBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	bike, ok := e.bikes[bikeID]
+	if !ok {
+		return nil, ErrBikeNotFound
+	}
+
+	return fromBike(bike), nil
+}
+
+func (e *memoryStore) UnLockBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error) {
+	return e.setBikeStatus(ctx, bikeID, models.BikeAvailable, &messaging.BikeUnlocked)
+}
+
+func (e *memoryStore) LockBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error) {
+	return e.setBikeStatus(ctx, bikeID, models.BikeInUse, &messaging.BikeLocked)
+}
+
+func (e *memoryStore) SetBikeStatus(ctx context.Context, bikeID string, status models.BikeStatus) (*models.Bike, error) {
+	return e.setBikeStatus(ctx, bikeID, status, nil)
+}
+
+// setBikeStatus moves a bike to status,
+// recording event in the outbox unless it is nil.
+func (e *memoryStore) setBikeStatus(ctx context.Context, bikeID string,
+	status models.BikeStatus, event *messaging.EventType) (*models.Bike, error) {
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	bike, ok := e.bikes[bikeID]
+	if !ok {
+		return nil, ErrBikeNotFound
+	}
+
+	if !bike.Status.CanTransitionTo(status) {
+		return nil, ErrIllegalTransition
+	}
+
+	bike.Status = status
+	if event != nil {
+		err := e.addOutboxEvent(ctx, *event, fromBike(bike))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e.bikes[bikeID] = bike
+
+	return fromBike(bike), nil
+}
+
+func (e *memoryStore) ListAllBikes(ctx context.Context, limit int64) ([]models.Bike, error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	bikes := []models.Bike{}
+	for _, id := range e.bikeIDs {
+		if int64(len(bikes)) >= limit {
+			break
+		}
+
+		bikes = append(bikes, *fromBike(e.bikes[id]))
+	}
+
+	e.logger.Infof("returned %d bikes", len(bikes))
+
+	return bikes, nil
+}
+
+func (e *memoryStore) ListBikes(ctx context.Context, cursor string, limit int64) ([]models.Bike, error) {
+	if cursor == "" {
+		return e.ListAllBikes(ctx, limit)
+	}
+
+	if limit == 0 {
+		limit = 20
+	}
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	ids := []string{}
+	for _, id := range e.bikeIDs {
+		if id <= cursor {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	bikes := []models.Bike{}
+	for _, id := range ids {
+		if int64(len(bikes)) >= limit {
+			break
+		}
+
+		bikes = append(bikes, *fromBike(e.bikes[id]))
+	}
+
+	e.logger.Infof("returned %d bikes", len(bikes))
+
+	return bikes, nil
+}
+
+func (e *memoryStore) ListBikesNear(ctx context.Context, lat, lng, radius float64, limit int64) ([]models.NearbyBike, error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	bikes := []models.NearbyBike{}
+	for _, id := range e.bikeIDs {
+		bike := e.bikes[id]
+
+		distance := geo.Distance(lat, lng, bike.Latitude, bike.Longitude)
+		if distance > radius {
+			continue
+		}
+
+		bikes = append(bikes, models.NearbyBike{
+			Bike:     *fromBike(bike),
+			Distance: distance,
+		})
+	}
+
+	sort.SliceStable(bikes, func(i, j int) bool {
+		return bikes[i].Distance < bikes[j].Distance
+	})
+
+	if int64(len(bikes)) > limit {
+		bikes = bikes[:limit]
+	}
+
+	e.logger.Infof("returned %d nearby bikes", len(bikes))
+
+	return bikes, nil
+}
+
+func (e *memoryStore) AddLocationToTrip(ctx context.Context, tripID string, lat, lng float64, recordedAt time.Time) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.addLocation(tripID, lat, lng, recordedAt)
+
+	e.logger.Info("added location to trip")
+
+	return nil
+}
+
+func (e *memoryStore) AddLocationsToTrips(ctx context.Context, locations []Location) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, location := range locations {
+		e.addLocation(location.TripID, location.Latitude, location.Longitude, location.RecordedAt.Time)
+	}
+
+	e.logger.Infof("added %d locations to trips", len(locations))
+
+	return nil
+}
+
+// addLocation appends a location to a trip.
+// The caller must hold the write lock.
+func (e *memoryStore) addLocation(tripID string, lat, lng float64, recordedAt time.Time) Location {
+	location := Location{
+		ID:         e.nextID(),
+		Latitude:   lat,
+		Longitude:  lng,
+		TripID:     tripID,
+		CreatedAt:  time.Now(),
+		RecordedAt: nullableTime(recordedAt),
+	}
+
+	e.locations[tripID] = append(e.locations[tripID], location)
+
+	return location
+}
+
+func (e *memoryStore) CreateTrip(ctx context.Context, bikeID, riderID string, lat, lng float64, recordedAt time.Time) (*models.Trip, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, t := range e.trips {
+		if t.BikeID == bikeID && t.Status == 1 {
+			return nil, ErrActiveTrip
+		}
+	}
+
+	trip := Trip{
+		ID:        e.nextID(),
+		PublicID:  entropy.FromContext(ctx).NewID(),
+		Status:    1,
+		BikeID:    bikeID,
+		StartedAt: time.Now(),
+		RiderID:   nullableString(riderID),
+	}
+
+	err := e.addOutboxEvent(ctx, messaging.TripStarted, fromTrip(trip, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	e.trips[trip.PublicID] = trip
+	location := e.addLocation(trip.PublicID, lat, lng, recordedAt)
+
+	e.logger.Info("successfully created trip")
+
+	return fromTrip(trip, []models.Location{location.toModel()}), nil
+}
+
+func (e *memoryStore) EndTrip(ctx context.Context, tripID string, lat, lng float64, recordedAt time.Time) (*models.Trip, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	trip, ok := e.trips[tripID]
+	if !ok {
+		return nil, ErrTripNotFound
+	}
+
+	if trip.Status != 1 {
+		return nil, ErrTripEnded
+	}
+
+	trip.Status = 0
+	trip.EndedAt = pq.NullTime{
+		Time:  time.Now(),
+		Valid: true,
+	}
+
+	e.addLocation(tripID, lat, lng, recordedAt)
+	trip.summarize(e.sortedLocations(tripID))
+
+	err := e.addOutboxEvent(ctx, messaging.TripEnded, fromTrip(trip, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	e.trips[tripID] = trip
+
+	e.logger.Info("successfully ended trip")
+
+	return fromTrip(trip, e.locationsForTrip(tripID)), nil
+}
+
+func (e *memoryStore) GetTrip(ctx context.Context, tripID string) (*models.Trip, error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	trip, ok := e.trips[tripID]
+	if !ok {
+		return nil, ErrTripNotFound
+	}
+
+	return fromTrip(trip, e.locationsForTrip(tripID)), nil
+}
+
+func (e *memoryStore) ListTripsForBike(ctx context.Context, bikeID, riderID string, cursor string, limit int64) ([]models.Trip, error) {
+	return e.listTrips(func(trip Trip) bool {
+		return trip.BikeID == bikeID
+	}, riderID, cursor, limit), nil
+}
+
+func (e *memoryStore) ListTrips(ctx context.Context, riderID string, from, to time.Time, statuses []int, cursor string, limit int64) ([]models.Trip, error) {
+	return e.listTrips(func(trip Trip) bool {
+		if !from.IsZero() && trip.StartedAt.Before(from) {
+			return false
+		}
+
+		if !to.IsZero() && !trip.StartedAt.Before(to) {
+			return false
+		}
+
+		if len(statuses) == 0 {
+			return true
+		}
+
+		for _, status := range statuses {
+			if trip.Status == status {
+				return true
+			}
+		}
+
+		return false
+	}, riderID, cursor, limit), nil
+}
+
+// listTrips lists the trips matching filter, and of riderID unless it is empty,
+// without their locations, newest first, as postgres does.
+func (e *memoryStore) listTrips(filter func(Trip) bool, riderID string, cursor string, limit int64) []models.Trip {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	ids := []string{}
+	for id, trip := range e.trips {
+		if riderID != "" && trip.RiderID.String != riderID {
+			continue
+		}
+
+		if (cursor == "" || id <= cursor) && filter(trip) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	trips := []models.Trip{}
+	for _, id := range ids {
+		if int64(len(trips)) >= limit {
+			break
+		}
+
+		trips = append(trips, *fromTrip(e.trips[id], nil))
+	}
+
+	e.logger.Infof("returned %d trips", len(trips))
+
+	return trips
+}
+
+func (e *memoryStore) GetLocationsForTrip(ctx context.Context, tripID string) ([]models.Location, error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	return e.locationsForTrip(tripID), nil
+}
+
+// locationsForTrip returns the locations of a trip ordered by time.
+// The caller must hold the lock.
+func (e *memoryStore) locationsForTrip(tripID string) []models.Location {
+	locations := e.sortedLocations(tripID)
+
+	count := len(locations)
+	e.logger.Infof("fetched %d location points", count)
+
+	correctLocations := make([]models.Location, 0, count)
+	for _, location := range locations {
+		correctLocations = append(correctLocations, location.toModel())
+	}
+
+	return correctLocations
+}
+
+// sortedLocations returns a copy of the locations of a trip ordered by time,
+// as postgres does. The caller must hold the lock.
+func (e *memoryStore) sortedLocations(tripID string) []Location {
+	locations := make([]Location, len(e.locations[tripID]))
+	copy(locations, e.locations[tripID])
+
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].Time().Before(locations[j].Time())
+	})
+
+	return locations
+}
+
+// MigrateUp has nothing to apply,
+// an in-memory database has no schema.
+func (e *memoryStore) MigrateUp(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return []Migration{}, nil
+}
+
+// MigrateDown has nothing to revert,
+// an in-memory database has no schema.
+func (e *memoryStore) MigrateDown(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	return []Migration{}, nil
+}
+
+// MigrationStatus reports every migration as applied.
+func (e *memoryStore) MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range sorted {
+		statuses = append(statuses, MigrationStatus{
+			Migration: migration,
+			Applied:   true,
+		})
+	}
+
+	return statuses, nil
+}
+
+func (e *memoryStore) Close(_ context.Context) error {
+	return nil
+}
+
+// fromBike converts a database bike to a models.Bike.
+func fromBike(b Bike) *models.Bike {
+	return &models.Bike{
+		ID:       b.PublicID,
+		Status:   b.Status,
+		Location: models.CreateLocation(b.Latitude, b.Longitude),
+	}
+}
+
+// fromTrip converts a database trip to a models.Trip.
+func fromTrip(t Trip, locations []models.Location) *models.Trip {
+	if locations == nil {
+		locations = []models.Location{}
+	}
+
+	return &models.Trip{
+		Locations: locations,
+
+		ID:        t.PublicID,
+		Status:    t.Status,
+		BikeID:    t.BikeID,
+		RiderID:   t.RiderID.String,
+		StartedAt: t.StartedAt,
+		EndedAt:   unwrapNullTime(t.EndedAt),
+		Summary:   fromTripSummary(t),
+	}
+}
+
+// fromTripSummary returns the summary of a trip,
+// nil until the trip is ended.
+func fromTripSummary(t Trip) *models.TripSummary {
+	if !t.Distance.Valid {
+		return nil
+	}
+
+	return &models.TripSummary{
+		Distance:     t.Distance.Float64,
+		Duration:     t.Duration.Float64,
+		AverageSpeed: t.AverageSpeed.Float64,
+		MaxSpeed:     t.MaxSpeed.Float64,
+	}
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// migrationLock is the key of the advisory lock
+// held while migrating, so that concurrent runners wait for each other.
+const migrationLock = 72946148
+
+// Migration queries.
+var (
+	createMigrationTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+								version bigint NOT NULL,
+								name character varying(255) NOT NULL,
+								applied_at timestamp with time zone NOT NULL DEFAULT now(),
+								CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+							);`
+
+	listMigrations  = `SELECT version, applied_at FROM schema_migrations ORDER BY version;`
+	insertMigration = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`
+	deleteMigration = `DELETE FROM schema_migrations WHERE version = $1;`
+
+	lockMigrations   = `SELECT pg_advisory_lock($1);`
+	unlockMigrations = `SELECT pg_advisory_unlock($1);`
+)
+
+// queryer is implemented by *sql.DB and *sql.Conn.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (e *pgStore) MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := e.appliedMigrations(ctx, e.database)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range sorted {
+		appliedAt, ok := applied[migration.Version]
+
+		status := MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+		}
+
+		if ok {
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (e *pgStore) MigrateUp(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	err = e.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := e.appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range sorted {
+			if steps > 0 && len(done) >= steps {
+				break
+			}
+
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err = e.runMigration(ctx, conn, migration.Up, insertMigration, migration.Version, migration.Name)
+			if err != nil {
+				return errors.Wrapf(err,
+					"an error occured while applying migration %d_%s", migration.Version, migration.Name)
+			}
+
+			e.logger.Infof("applied migration %d_%s", migration.Version, migration.Name)
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+func (e *pgStore) MigrateDown(ctx context.Context, migrations []Migration, steps int) ([]Migration, error) {
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	if steps <= 0 {
+		steps = 1
+	}
+
+	done := []Migration{}
+	err = e.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := e.appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(sorted) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := sorted[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err = e.runMigration(ctx, conn, migration.Down, deleteMigration, migration.Version)
+			if err != nil {
+				return errors.Wrapf(err,
+					"an error occured while reverting migration %d_%s", migration.Version, migration.Name)
+			}
+
+			e.logger.Infof("reverted migration %d_%s", migration.Version, migration.Name)
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// withMigrationLock runs callback on a single connection
+// holding the migration advisory lock.
+func (e *pgStore) withMigrationLock(ctx context.Context, callback func(*sql.Conn) error) error {
+	conn, err := e.database.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while acquiring a connection for migrations")
+	}
+
+	defer func() {
+		thr := conn.Close()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while releasing migration connection")
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, lockMigrations, migrationLock)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while locking migrations")
+	}
+
+	defer func() {
+		_, thr := conn.ExecContext(context.Background(), unlockMigrations, migrationLock)
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while unlocking migrations")
+		}
+	}()
+
+	return callback(conn)
+}
+
+// runMigration executes a migration script and records it
+// in schema_migrations within the same transaction.
+func (e *pgStore) runMigration(ctx context.Context, conn *sql.Conn,
+	script, record string, args ...interface{}) error {
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while begin transaction for migration")
+	}
+
+	_, err = tx.ExecContext(ctx, script)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, record, args...)
+	}
+
+	if err != nil {
+		thr := tx.Rollback()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while rollbacking transaction")
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// appliedMigrations returns the applied versions with their date,
+// creating schema_migrations when missing.
+func (e *pgStore) appliedMigrations(ctx context.Context, db queryer) (map[int64]time.Time, error) {
+	_, err := db.ExecContext(ctx, createMigrationTable)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while creating schema_migrations")
+	}
+
+	rows, err := db.QueryContext(ctx, listMigrations)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while listing applied migrations")
+	}
+
+	defer func() {
+		thr := rows.Close()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while closing query")
+		}
+	}()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				"an error occured while scanning for migration")
+		}
+
+		applied[version] = appliedAt
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured during iteration over applied migrations")
+	}
+
+	return applied, nil
+}
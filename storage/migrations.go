@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/logging"
+)
+
+// Migration is a versioned and reversible change
+// of a database schema.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a Migration
+// has been applied to a database.
+type MigrationStatus struct {
+	Migration
+
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrator specifies how a Store evolves its schema.
+type Migrator interface {
+	// MigrateUp applies at most steps pending migrations,
+	// all of them when steps is not positive.
+	MigrateUp(ctx context.Context, migrations []Migration, steps int) ([]Migration, error)
+
+	// MigrateDown reverts the steps last applied migrations,
+	// only one when steps is not positive.
+	MigrateDown(ctx context.Context, migrations []Migration, steps int) ([]Migration, error)
+
+	MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationStatus, error)
+}
+
+// EnsureSchema checks that every migration has been applied,
+// and applies the pending ones when autoMigrate is set.
+func EnsureSchema(ctx context.Context, migrator Migrator, migrations []Migration,
+	autoMigrate bool, logger logging.Logger) error {
+
+	statuses, err := migrator.MigrationStatus(ctx, migrations)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while reading schema status")
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+
+	if pending == 0 {
+		logger.Info("database schema is up to date")
+		return nil
+	}
+
+	if !autoMigrate {
+		return errors.Wrapf(ErrSchemaBehind, "%d pending migrations", pending)
+	}
+
+	applied, err := migrator.MigrateUp(ctx, migrations, 0)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while migrating database schema")
+	}
+
+	logger.Infof("applied %d migrations", len(applied))
+
+	return nil
+}
+
+// sortMigrations returns the migrations ordered by version,
+// and rejects duplicated versions.
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, errors.Errorf("duplicated migration version: %d", sorted[i].Version)
+		}
+	}
+
+	return sorted, nil
+}
+
+// BikeMigrations holds the schema of the bike database.
+var BikeMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_bikes",
+		Up: `CREATE TABLE IF NOT EXISTS bikes (
+				id serial   NOT NULL,
+				public_id character varying(26) UNIQUE NOT NULL,
+				latitude real NOT NULL,
+				longitude real NOT NULL,
+				status integer  NOT NULL DEFAULT 1,
+				CONSTRAINT bikes_pkey PRIMARY KEY (id)
+			)
+			With(OIDS=FALSE);`,
+		Down: `DROP TABLE IF EXISTS bikes;`,
+	},
+	{
+		Version: 2,
+		Name:    "index_bikes_location",
+		Up:      `CREATE INDEX IF NOT EXISTS bikes_location_idx ON bikes (latitude, longitude);`,
+		Down:    `DROP INDEX IF EXISTS bikes_location_idx;`,
+	},
+	{
+		Version: 3,
+		Name:    "create_outbox",
+		// events are written along the changes they describe,
+		// and relayed to the broker once committed.
+		Up: `CREATE TABLE IF NOT EXISTS outbox (
+				id character varying(26) NOT NULL,
+				event_type text NOT NULL,
+				event_version integer NOT NULL,
+				correlation_id text,
+				trace jsonb,
+				payload jsonb NOT NULL,
+				occurred_at timestamptz NOT NULL DEFAULT now(),
+				sent_at timestamptz,
+				CONSTRAINT outbox_pkey PRIMARY KEY (id)
+			)
+			With(OIDS=FALSE);
+
+			CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (occurred_at) WHERE sent_at IS NULL;`,
+		Down: `DROP TABLE IF EXISTS outbox;`,
+	},
+	{
+		Version: 4,
+		Name:    "index_outbox_sent",
+		// sent events are deleted once past their retention.
+		Up:   `CREATE INDEX IF NOT EXISTS outbox_sent_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;`,
+		Down: `DROP INDEX IF EXISTS outbox_sent_idx;`,
+	},
+	{
+		Version: 5,
+		Name:    "swap_seeded_coordinates",
+		// bikes seeded before the registry was read as GeoJSON have their
+		// latitude and longitude swapped: the registry lies in Paris,
+		// whose latitude exceeds its longitude.
+		Up: `UPDATE bikes SET latitude = longitude, longitude = latitude
+				WHERE public_id LIKE '` + seededBikesPrefix + `%' AND latitude < longitude;`,
+		Down: `UPDATE bikes SET latitude = longitude, longitude = latitude
+				WHERE public_id LIKE '` + seededBikesPrefix + `%' AND latitude > longitude;`,
+	},
+}
+
+// seededBikesPrefix starts the ids of the bikes seeded from the registry.
+const seededBikesPrefix = "bb3398hl52n3nnikk"
+
+// TripMigrations holds the schema of the trip database.
+var TripMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_trips_and_locations",
+		Up: `CREATE TABLE IF NOT EXISTS trips (
+				id serial   NOT NULL,
+				started_at date NOT NULL DEFAULT CURRENT_DATE,
+				ended_at date,
+				public_id character varying(26) UNIQUE NOT NULL,
+				bike_id character varying(26)   NOT NULL,
+				status integer  NOT NULL,
+				CONSTRAINT trips_pkey PRIMARY KEY (id)
+			)
+			With(OIDS=FALSE);
+
+			CREATE TABLE IF NOT EXISTS locations (
+				id serial   NOT NULL,
+				latitude real NOT NULL,
+				longitude real NOT NULL,
+				trip_id character varying(26) NOT NULL,
+				created_at date NOT NULL DEFAULT CURRENT_DATE,
+				CONSTRAINT locations_pkey PRIMARY KEY (id)
+			)
+			With(OIDS=FALSE);`,
+		Down: `DROP TABLE IF EXISTS locations;
+			DROP TABLE IF EXISTS trips;`,
+	},
+	{
+		Version: 2,
+		Name:    "unique_active_trip_per_bike",
+		// closes duplicated active trips, keeping the latest one,
+		// before a bike is restricted to a single active trip.
+		Up: `UPDATE trips SET status = 0, ended_at = COALESCE(ended_at, CURRENT_DATE)
+				WHERE status = 1 AND id NOT IN (
+					SELECT max(id) FROM trips WHERE status = 1 GROUP BY bike_id
+				);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS trips_active_bike_idx ON trips (bike_id) WHERE status = 1;`,
+		Down: `DROP INDEX IF EXISTS trips_active_bike_idx;`,
+	},
+	{
+		Version: 3,
+		Name:    "add_trip_summary",
+		Up: `ALTER TABLE trips ADD COLUMN IF NOT EXISTS distance double precision,
+				ADD COLUMN IF NOT EXISTS duration double precision,
+				ADD COLUMN IF NOT EXISTS average_speed double precision,
+				ADD COLUMN IF NOT EXISTS max_speed double precision;`,
+		Down: `ALTER TABLE trips DROP COLUMN IF EXISTS distance,
+				DROP COLUMN IF EXISTS duration,
+				DROP COLUMN IF EXISTS average_speed,
+				DROP COLUMN IF EXISTS max_speed;`,
+	},
+	{
+		Version: 4,
+		Name:    "precise_trip_timestamps",
+		// existing dates become midnight,
+		// their locations keep their insertion order through their id.
+		Up: `ALTER TABLE trips ALTER COLUMN started_at TYPE timestamptz USING started_at::timestamptz,
+				ALTER COLUMN started_at SET DEFAULT now(),
+				ALTER COLUMN ended_at TYPE timestamptz USING ended_at::timestamptz;
+
+			ALTER TABLE locations ALTER COLUMN created_at TYPE timestamptz USING created_at::timestamptz,
+				ALTER COLUMN created_at SET DEFAULT now(),
+				ADD COLUMN IF NOT EXISTS recorded_at timestamptz;`,
+		Down: `ALTER TABLE locations DROP COLUMN IF EXISTS recorded_at,
+				ALTER COLUMN created_at TYPE date USING created_at::date,
+				ALTER COLUMN created_at SET DEFAULT CURRENT_DATE;
+
+			ALTER TABLE trips ALTER COLUMN started_at TYPE date USING started_at::date,
+				ALTER COLUMN started_at SET DEFAULT CURRENT_DATE,
+				ALTER COLUMN ended_at TYPE date USING ended_at::date;`,
+	},
+	{
+		Version: 5,
+		Name:    "trip_riders",
+		// trips started before riders were authenticated have none.
+		Up: `ALTER TABLE trips ADD COLUMN IF NOT EXISTS rider_id text;
+			CREATE INDEX IF NOT EXISTS trips_rider_idx ON trips (rider_id);`,
+		Down: `DROP INDEX IF EXISTS trips_rider_idx;
+			ALTER TABLE trips DROP COLUMN IF EXISTS rider_id;`,
+	},
+	{
+		Version: 6,
+		Name:    "create_outbox",
+		// events are written along the changes they describe,
+		// and relayed to the broker once committed.
+		Up: `CREATE TABLE IF NOT EXISTS outbox (
+				id character varying(26) NOT NULL,
+				event_type text NOT NULL,
+				event_version integer NOT NULL,
+				correlation_id text,
+				trace jsonb,
+				payload jsonb NOT NULL,
+				occurred_at timestamptz NOT NULL DEFAULT now(),
+				sent_at timestamptz,
+				CONSTRAINT outbox_pkey PRIMARY KEY (id)
+			)
+			With(OIDS=FALSE);
+
+			CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (occurred_at) WHERE sent_at IS NULL;`,
+		Down: `DROP TABLE IF EXISTS outbox;`,
+	},
+	{
+		Version: 7,
+		Name:    "index_outbox_sent",
+		// sent events are deleted once past their retention.
+		Up:   `CREATE INDEX IF NOT EXISTS outbox_sent_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;`,
+		Down: `DROP INDEX IF EXISTS outbox_sent_idx;`,
+	},
+}
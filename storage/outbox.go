@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/messaging"
+)
+
+// OutboxStore specifies how the domain events, written
+// along the changes they describe, are handed to the relay.
+type OutboxStore interface {
+	// RelayEvents hands up to limit events not sent yet, oldest first,
+	// to relay, and marks sent the ids it returns. A single replica
+	// relays the events at once, the others being handed none.
+	// It returns the number of events handed to relay.
+	RelayEvents(ctx context.Context, limit int64, relay func([]messaging.Envelope) []string) (int, error)
+
+	// DeleteSentEvents deletes the events sent before a time.
+	DeleteSentEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Outbox Queries.
+var (
+	addOutboxEvent = `INSERT INTO outbox (id, event_type, event_version, correlation_id, trace, payload, occurred_at)
+							VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+	// the lock is released along its transaction.
+	lockOutbox = `SELECT pg_try_advisory_xact_lock(hashtext('outbox'));`
+
+	listPendingEvents = `SELECT id, event_type, event_version, correlation_id, trace, payload, occurred_at
+							FROM outbox WHERE sent_at IS NULL ORDER BY occurred_at, id LIMIT $1;`
+
+	markEventsSent = `UPDATE outbox SET sent_at = now() WHERE id = ANY($1) AND sent_at IS NULL;`
+
+	deleteSentEvents = `DELETE FROM outbox WHERE sent_at < $1;`
+)
+
+// addOutboxEvent records an event in the outbox
+// within the transaction of the change it describes.
+func (e *pgStore) addOutboxEvent(ctx context.Context, tx *sql.Tx,
+	event messaging.EventType, payload interface{}) error {
+
+	envelope, err := messaging.NewEnvelope(ctx, event, payload)
+	if err != nil {
+		return err
+	}
+
+	trace := sql.NullString{}
+	if len(envelope.Trace) > 0 {
+		raw, err := json.Marshal(envelope.Trace)
+		if err != nil {
+			return errors.Wrap(err, "an error occured while encoding event trace")
+		}
+
+		trace = sql.NullString{String: string(raw), Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx, addOutboxEvent, envelope.ID, envelope.Type, envelope.Version,
+		nullableString(envelope.CorrelationID), trace, string(envelope.Payload), envelope.OccurredAt)
+	if err != nil {
+		return errors.Wrapf(err,
+			"an error occured while writing %s event in outbox", envelope.Type)
+	}
+
+	return nil
+}
+
+// RelayEvents relays the pending events within a transaction holding
+// an advisory lock: a replica failing to take it relays nothing, so that
+// events are neither published twice at once nor out of order.
+func (e *pgStore) RelayEvents(ctx context.Context, limit int64,
+	relay func([]messaging.Envelope) []string) (_ int, err error) {
+
+	ctx, span := startSpan(ctx, "RelayEvents")
+	defer endSpan(span, &err)
+
+	tx, err := e.database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err,
+			"an error occured while begin transaction for outbox relay")
+	}
+
+	defer func() {
+		thr := tx.Rollback()
+		if thr != nil && thr != sql.ErrTxDone {
+			e.logger.WithError(thr).Warn("error while rollbacking transaction")
+		}
+	}()
+
+	locked := false
+	err = tx.QueryRowContext(ctx, lockOutbox).Scan(&locked)
+	if err != nil {
+		return 0, errors.Wrap(err,
+			"an error occured while locking outbox")
+	}
+
+	if !locked {
+		return 0, nil
+	}
+
+	events, err := e.pendingEvents(ctx, tx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := relay(events)
+	if len(sent) > 0 {
+		_, err = tx.ExecContext(ctx, markEventsSent, pq.Array(sent))
+		if err != nil {
+			return 0, errors.Wrap(err,
+				"an error occured while marking events as sent")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.Wrap(err,
+			"an error occured while committing a transaction")
+	}
+
+	return len(events), nil
+}
+
+// pendingEvents lists the events not sent yet, oldest first.
+func (e *pgStore) pendingEvents(ctx context.Context, tx *sql.Tx, limit int64) ([]messaging.Envelope, error) {
+	rows, err := tx.QueryContext(ctx, listPendingEvents, limit)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while listing pending events")
+	}
+
+	defer func() {
+		thr := rows.Close()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while closing rows")
+		}
+	}()
+
+	events := []messaging.Envelope{}
+	for rows.Next() {
+		var (
+			event         messaging.Envelope
+			correlationID sql.NullString
+			trace         []byte
+			payload       []byte
+		)
+
+		err = rows.Scan(&event.ID, &event.Type, &event.Version,
+			&correlationID, &trace, &payload, &event.OccurredAt)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				"an error occured while reading pending event")
+		}
+
+		if len(trace) > 0 {
+			err = json.Unmarshal(trace, &event.Trace)
+			if err != nil {
+				return nil, errors.Wrapf(err,
+					"an error occured while decoding trace of event %s", event.ID)
+			}
+		}
+
+		event.CorrelationID = correlationID.String
+		event.Payload = payload
+		event.OccurredAt = event.OccurredAt.UTC()
+
+		events = append(events, event)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while listing pending events")
+	}
+
+	return events, nil
+}
+
+func (e *pgStore) DeleteSentEvents(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "DeleteSentEvents")
+	defer endSpan(span, &err)
+
+	result, err := e.database.ExecContext(ctx, deleteSentEvents, before)
+	if err != nil {
+		return 0, errors.Wrap(err,
+			"an error occured while deleting sent events")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err,
+			"an error occured while deleting sent events")
+	}
+
+	return deleted, nil
+}
+
+// addOutboxEvent records an event in the outbox.
+// The caller must hold the write lock.
+func (e *memoryStore) addOutboxEvent(ctx context.Context, event messaging.EventType, payload interface{}) error {
+	envelope, err := messaging.NewEnvelope(ctx, event, payload)
+	if err != nil {
+		return err
+	}
+
+	e.outbox = append(e.outbox, envelope)
+	return nil
+}
+
+// RelayEvents relays the pending events one relay at a time,
+// without holding the store while they are published.
+func (e *memoryStore) RelayEvents(ctx context.Context, limit int64,
+	relay func([]messaging.Envelope) []string) (int, error) {
+
+	e.relayMutex.Lock()
+	defer e.relayMutex.Unlock()
+
+	e.mutex.RLock()
+	if int64(len(e.outbox)) < limit {
+		limit = int64(len(e.outbox))
+	}
+
+	events := append([]messaging.Envelope{}, e.outbox[:limit]...)
+	e.mutex.RUnlock()
+
+	sent := relay(events)
+	if len(sent) > 0 {
+		e.markEventsSent(sent)
+	}
+
+	return len(events), nil
+}
+
+// markEventsSent drops the sent events, as nothing reads them afterwards.
+func (e *memoryStore) markEventsSent(eventIDs []string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	sent := make(map[string]bool, len(eventIDs))
+	for _, id := range eventIDs {
+		sent[id] = true
+	}
+
+	pending := []messaging.Envelope{}
+	for _, event := range e.outbox {
+		if !sent[event.ID] {
+			pending = append(pending, event)
+		}
+	}
+
+	e.outbox = pending
+}
+
+// DeleteSentEvents has nothing to delete,
+// the sent events being dropped right away.
+func (e *memoryStore) DeleteSentEvents(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
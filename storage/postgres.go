@@ -3,16 +3,16 @@ package storage
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"sort"
+	"time"
 
-	// loading postgres drivers
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/entropy"
+	"github.com/EarvinKayonga/rider/geo"
 	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/messaging"
 	"github.com/EarvinKayonga/rider/models"
 )
 
@@ -28,16 +28,23 @@ type pgStore struct {
 func NewPostgresDatabase(ctx context.Context,
 	config configuration.Database, logger logging.Logger) (Store, error) {
 
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		config.Host, config.Port,
-		config.User, config.Password, config.Name)
-
-	db, err := sql.Open("postgres", psqlInfo)
+	db, err := sql.Open("postgres", config.DSN())
 	if err != nil {
 		return nil, errors.Wrapf(err,
-			"an error occured while connecting to database with %v",
-			config)
+			"an error occured while connecting to database %s at %s:%s",
+			config.Name, config.Host, config.Port)
+	}
+
+	if config.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.MaxOpenConns)
+	}
+
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+
+	if config.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(config.ConnMaxLifetime)
 	}
 
 	err = db.Ping()
@@ -54,12 +61,15 @@ func NewPostgresDatabase(ctx context.Context,
 	}, nil
 }
 
-func (e *pgStore) CreateBikes(ctx context.Context, bikes []Bike) ([]models.Bike, error) {
+func (e *pgStore) CreateBikes(ctx context.Context, bikes []Bike) (_ []models.Bike, err error) {
+	ctx, span := startSpan(ctx, "CreateBikes")
+	defer endSpan(span, &err)
+
 	created := []models.Bike{}
 	for _, b := range bikes {
 		bike, err := toBike(e.
 			database.
-			QueryRow(createBike, b.PublicID, b.Latitude, b.Longitude, b.Status))
+			QueryRowContext(ctx, createBike, b.PublicID, b.Latitude, b.Longitude, b.Status))
 
 		if err != nil {
 			return nil, errors.Wrap(err, "an error occured while inserting a bike in db")
@@ -73,16 +83,19 @@ func (e *pgStore) CreateBikes(ctx context.Context, bikes []Bike) ([]models.Bike,
 	return created, nil
 }
 
-func (e *pgStore) UpdateBikeLocation(ctx context.Context, bikeID string, lat, lng float64) error {
-	result, err := e.database.Exec(updateBikeLocation, bikeID, lat, lng)
+func (e *pgStore) UpdateBikeLocation(ctx context.Context, bikeID string, lat, lng float64) (err error) {
+	ctx, span := startSpan(ctx, "UpdateBikeLocation")
+	defer endSpan(span, &err)
+
+	result, err := e.database.ExecContext(ctx, updateBikeLocation, bikeID, lat, lng)
 	if err != nil {
-		errors.Wrap(err,
+		return errors.Wrap(err,
 			"an error occured while updating bike location")
 	}
 
 	count, err := result.RowsAffected()
 	if err != nil {
-		errors.Wrap(err,
+		return errors.Wrap(err,
 			"an error occured while checking nbs of affected rows through updating bike location")
 	}
 
@@ -94,26 +107,122 @@ func (e *pgStore) UpdateBikeLocation(ctx context.Context, bikeID string, lat, ln
 	return nil
 }
 
-func (e *pgStore) FindBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error) {
+func (e *pgStore) UpdateBikeLocations(ctx context.Context, bikes []Bike) (err error) {
+	ctx, span := startSpan(ctx, "UpdateBikeLocations")
+	defer endSpan(span, &err)
+
+	bikes = lastLocations(bikes)
+	if len(bikes) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(bikes))
+	latitudes := make([]float64, 0, len(bikes))
+	longitudes := make([]float64, 0, len(bikes))
+	for _, bike := range bikes {
+		ids = append(ids, bike.PublicID)
+		latitudes = append(latitudes, bike.Latitude)
+		longitudes = append(longitudes, bike.Longitude)
+	}
+
+	result, err := e.database.ExecContext(ctx, updateBikeLocations,
+		pq.Array(ids), pq.Array(latitudes), pq.Array(longitudes))
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while updating bike locations")
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while checking nbs of affected rows through updating bike locations")
+	}
+
+	e.logger.Infof("location of %d bikes updated", count)
+	return nil
+}
+
+func (e *pgStore) FindBikeByPublicID(ctx context.Context, bikeID string) (_ *models.Bike, err error) {
+	ctx, span := startSpan(ctx, "FindBikeByPublicID")
+	defer endSpan(span, &err)
+
 	return toBike(e.
 		database.
-		QueryRow(findBikeByPublicID, bikeID))
+		QueryRowContext(ctx, findBikeByPublicID, bikeID))
 }
 
 func (e *pgStore) UnLockBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error) {
-	return toBike(e.
-		database.
-		QueryRow(unlockBikeByPublicID, bikeID))
+	return e.setBikeStatus(ctx, bikeID, models.BikeAvailable, &messaging.BikeUnlocked)
 }
 
 func (e *pgStore) LockBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error) {
-	return toBike(e.
-		database.
-		QueryRow(lockBikeByPublicID, bikeID))
+	return e.setBikeStatus(ctx, bikeID, models.BikeInUse, &messaging.BikeLocked)
+}
+
+func (e *pgStore) SetBikeStatus(ctx context.Context, bikeID string, status models.BikeStatus) (*models.Bike, error) {
+	return e.setBikeStatus(ctx, bikeID, status, nil)
 }
 
-func (e *pgStore) ListAllBikes(ctx context.Context, limit int64) ([]models.Bike, error) {
-	rows, err := e.database.Query(listAllBikes, limit)
+// setBikeStatus moves a bike to status, recording event
+// in the outbox within the same transaction unless it is nil.
+func (e *pgStore) setBikeStatus(ctx context.Context, bikeID string,
+	status models.BikeStatus, event *messaging.EventType) (_ *models.Bike, err error) {
+
+	ctx, span := startSpan(ctx, "SetBikeStatus")
+	defer endSpan(span, &err)
+
+	from := []int64{}
+	for _, s := range models.AllowedFrom(status) {
+		from = append(from, int64(s))
+	}
+
+	tx, err := e.database.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while begin transaction for bike status")
+	}
+
+	bike, err := toBike(tx.QueryRowContext(ctx, setBikeStatus, bikeID, status, pq.Array(from)))
+	if err == nil && event != nil {
+		err = e.addOutboxEvent(ctx, tx, *event, bike)
+	}
+
+	if err != nil {
+		defer func() {
+			thr := tx.Rollback()
+			if thr != nil {
+				e.logger.WithError(thr).Warn("error while rollbacking transaction")
+			}
+		}()
+
+		if err != ErrBikeNotFound {
+			return nil, err
+		}
+
+		// nothing was updated: either the bike does not exist,
+		// or its current status forbids the transition.
+		_, err = e.FindBikeByPublicID(ctx, bikeID)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrIllegalTransition
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while committing a transaction")
+	}
+
+	return bike, nil
+}
+
+func (e *pgStore) ListAllBikes(ctx context.Context, limit int64) (_ []models.Bike, err error) {
+	ctx, span := startSpan(ctx, "ListAllBikes")
+	defer endSpan(span, &err)
+
+	rows, err := e.database.QueryContext(ctx, listAllBikes, limit)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while listing bikes from the database")
@@ -154,17 +263,20 @@ func (e *pgStore) ListAllBikes(ctx context.Context, limit int64) ([]models.Bike,
 func (e *pgStore) optionsList(ctx context.Context, cursor string, limit int64) (*sql.Rows, error) {
 
 	if cursor == "" {
-		return e.database.Query(listAllBikes, limit)
+		return e.database.QueryContext(ctx, listAllBikes, limit)
 	}
 
 	if limit == 0 {
 		limit = 20
 	}
 
-	return e.database.Query(listBikes, limit, cursor)
+	return e.database.QueryContext(ctx, listBikes, limit, cursor)
 }
 
-func (e *pgStore) ListBikes(ctx context.Context, cursor string, limit int64) ([]models.Bike, error) {
+func (e *pgStore) ListBikes(ctx context.Context, cursor string, limit int64) (_ []models.Bike, err error) {
+	ctx, span := startSpan(ctx, "ListBikes")
+	defer endSpan(span, &err)
+
 	rows, err := e.optionsList(ctx, cursor, limit)
 	if err != nil {
 		return nil, errors.Wrap(err,
@@ -203,11 +315,57 @@ func (e *pgStore) ListBikes(ctx context.Context, cursor string, limit int64) ([]
 	return bikes, nil
 }
 
-func (e *pgStore) AddLocationToTrip(ctx context.Context, tripID string, lat, lng float64) error {
-	_, err := toLocation(
+func (e *pgStore) ListBikesNear(ctx context.Context, lat, lng, radius float64, limit int64) (_ []models.NearbyBike, err error) {
+	ctx, span := startSpan(ctx, "ListBikesNear")
+	defer endSpan(span, &err)
+
+	minLat, maxLat, minLng, maxLng := geo.BoundingBox(lat, lng, radius)
+
+	rows, err := e.database.QueryContext(ctx, listBikesNear, lat, lng,
+		minLat, maxLat, minLng, maxLng, radius, geo.EarthRadius, limit)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while listing nearby bikes from the database")
+	}
+
+	defer func() {
+		thr := rows.Close()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while closing query")
+		}
+	}()
+
+	bikes := []models.NearbyBike{}
+
+	for rows.Next() {
+		bike, err := toNearbyBike(rows)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				"an error occured while querying a nearby bike")
+		}
+
+		bikes = append(bikes, *bike)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured during iteration over returned nearby bikes")
+	}
+
+	e.logger.Infof("returned %d nearby bikes", len(bikes))
+
+	return bikes, nil
+}
+
+func (e *pgStore) AddLocationToTrip(ctx context.Context, tripID string, lat, lng float64, recordedAt time.Time) (err error) {
+	ctx, span := startSpan(ctx, "AddLocationToTrip")
+	defer endSpan(span, &err)
+
+	_, err = toLocation(
 		e.
 			database.
-			QueryRow(addLocationToTrip, lat, lng, tripID))
+			QueryRowContext(ctx, addLocationToTrip, lat, lng, tripID, nullableTime(recordedAt)))
 
 	if err != nil {
 		return errors.Wrap(err,
@@ -219,14 +377,69 @@ func (e *pgStore) AddLocationToTrip(ctx context.Context, tripID string, lat, lng
 	return nil
 }
 
-func (e *pgStore) CreateTrip(ctx context.Context, bikeID string, lat, lng float64) (*models.Trip, error) {
-	tx, err := e.database.Begin()
+func (e *pgStore) AddLocationsToTrips(ctx context.Context, locations []Location) (err error) {
+	ctx, span := startSpan(ctx, "AddLocationsToTrips")
+	defer endSpan(span, &err)
+
+	if len(locations) == 0 {
+		return nil
+	}
+
+	latitudes := make([]float64, 0, len(locations))
+	longitudes := make([]float64, 0, len(locations))
+	tripIDs := make([]string, 0, len(locations))
+
+	// times are sent as text, NULL when unknown.
+	recordedAts := make([]sql.NullString, 0, len(locations))
+	for _, location := range locations {
+		latitudes = append(latitudes, location.Latitude)
+		longitudes = append(longitudes, location.Longitude)
+		tripIDs = append(tripIDs, location.TripID)
+
+		recordedAt := sql.NullString{}
+		if location.RecordedAt.Valid {
+			recordedAt.String = location.RecordedAt.Time.Format(time.RFC3339Nano)
+			recordedAt.Valid = true
+		}
+
+		recordedAts = append(recordedAts, recordedAt)
+	}
+
+	_, err = e.database.ExecContext(ctx, addLocationsToTrips, pq.Array(latitudes),
+		pq.Array(longitudes), pq.Array(tripIDs), pq.Array(recordedAts))
+	if err != nil {
+		return errors.Wrap(err,
+			"an error occured while adding locations to trips")
+	}
+
+	e.logger.Infof("added %d locations to trips", len(locations))
+
+	return nil
+}
+
+func (e *pgStore) CreateTrip(ctx context.Context, bikeID, riderID string, lat, lng float64, recordedAt time.Time) (_ *models.Trip, err error) {
+	ctx, span := startSpan(ctx, "CreateTrip")
+	defer endSpan(span, &err)
+
+	tx, err := e.database.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while begin transaction for trip creation")
 	}
 
-	stmt, err := tx.Prepare(createTrip)
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+
+		thr := tx.Rollback()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while rollbacking transaction")
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, createTrip)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while preparing transaction for trip creation")
@@ -241,32 +454,18 @@ func (e *pgStore) CreateTrip(ctx context.Context, bikeID string, lat, lng float6
 		}()
 	}
 
-	trip, err := toTrip(stmt.QueryRow(bikeID, entropy.NewIDGenerator().NewID(), 1))
+	trip, err := toTrip(stmt.QueryRowContext(ctx, bikeID, entropy.FromContext(ctx).NewID(), 1,
+		nullableString(riderID)))
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
+		if isUniqueViolation(err, activeTripIndex) {
+			return nil, ErrActiveTrip
+		}
 
 		return nil, errors.Wrap(err,
 			"an error occured while writing trip in database")
 	}
 
-	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
-
-		return nil, errors.Wrap(err,
-			"an error occured while writing locking bike in database")
-	}
-
-	stmt, err = tx.Prepare(addLocationToTrip)
+	stmt, err = tx.PrepareContext(ctx, addLocationToTrip)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while preparing location transaction for trip creation")
@@ -281,67 +480,53 @@ func (e *pgStore) CreateTrip(ctx context.Context, bikeID string, lat, lng float6
 		}()
 	}
 
-	location, err := toLocation(stmt.QueryRow(lat, lng, trip.PublicID))
+	location, err := toLocation(stmt.QueryRowContext(ctx, lat, lng, trip.PublicID, nullableTime(recordedAt)))
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
-
 		return nil, errors.Wrap(err,
 			"an error occured while writing trip in database")
 	}
 
+	err = e.addOutboxEvent(ctx, tx, messaging.TripStarted, fromTrip(*trip, nil))
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
-
-		return nil, errors.Wrap(err,
-			"an error occured while writing locking bike in database")
+		return nil, err
 	}
 
+	// the transaction is over, even when its commit failed.
 	err = tx.Commit()
+	committed = true
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
-
 		return nil, errors.Wrap(err,
 			"an error occured while committing a transaction")
 	}
 
 	e.logger.Info("successfully created trip")
 
-	return &models.Trip{
-		Locations: []models.Location{
-			models.CreateLocation(location.Latitude, location.Longitude),
-		},
-
-		ID:        trip.PublicID,
-		Status:    trip.Status,
-		BikeID:    trip.BikeID,
-		StartedAt: trip.StartedAt,
-		EndedAt:   unwrapNullTime(trip.EndedAt),
-	}, nil
+	return fromTrip(*trip, []models.Location{location.toModel()}), nil
 }
 
-func (e *pgStore) EndTrip(ctx context.Context, tripID string, lat, lng float64) (*models.Trip, error) {
-	tx, err := e.database.Begin()
+func (e *pgStore) EndTrip(ctx context.Context, tripID string, lat, lng float64, recordedAt time.Time) (_ *models.Trip, err error) {
+	ctx, span := startSpan(ctx, "EndTrip")
+	defer endSpan(span, &err)
+
+	tx, err := e.database.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while begin transaction for trip ending")
 	}
 
-	stmt, err := tx.Prepare(endTrip)
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+
+		thr := tx.Rollback()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while rollbacking transaction")
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, endTrip)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while preparing transaction for trip ending")
@@ -356,20 +541,22 @@ func (e *pgStore) EndTrip(ctx context.Context, tripID string, lat, lng float64)
 		}()
 	}
 
-	trip, err := toTrip(stmt.QueryRow(tripID))
+	trip, err := toTrip(stmt.QueryRowContext(ctx, tripID))
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
+		if err == ErrTripNotFound {
+			// nothing was updated: either the trip does not exist,
+			// or it has already been ended.
+			_, err = toTrip(e.database.QueryRowContext(ctx, listTrip, tripID))
+			if err == nil {
+				return nil, ErrTripEnded
 			}
-		}()
+		}
 
 		return nil, errors.Wrap(err,
 			"an error occured while writing trip in database")
 	}
 
-	stmt, err = tx.Prepare(addLocationToTrip)
+	stmt, err = tx.PrepareContext(ctx, addLocationToTrip)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while preparing transaction for trip ending")
@@ -384,40 +571,34 @@ func (e *pgStore) EndTrip(ctx context.Context, tripID string, lat, lng float64)
 		}()
 	}
 
-	_, err = toLocation(stmt.QueryRow(lat, lng, trip.PublicID))
+	_, err = toLocation(stmt.QueryRowContext(ctx, lat, lng, trip.PublicID, nullableTime(recordedAt)))
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
-
 		return nil, errors.Wrap(err,
 			"an error occured while writing trip in database")
 	}
 
+	trackedLocations, err := e.queryLocations(ctx, tx, trip.PublicID)
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
+		return nil, err
+	}
 
+	trip.summarize(trackedLocations)
+	trip, err = toTrip(tx.QueryRowContext(ctx, setTripSummary, trip.PublicID, trip.Distance,
+		trip.Duration, trip.AverageSpeed, trip.MaxSpeed))
+	if err != nil {
 		return nil, errors.Wrap(err,
-			"an error occured while writing location in database")
+			"an error occured while writing trip summary in database")
 	}
 
-	err = tx.Commit()
+	err = e.addOutboxEvent(ctx, tx, messaging.TripEnded, fromTrip(*trip, nil))
 	if err != nil {
-		defer func() {
-			thr := tx.Rollback()
-			if thr != nil {
-				e.logger.WithError(thr).Warn("error while rollbacking transaction")
-			}
-		}()
+		return nil, err
+	}
 
+	// the transaction is over, even when its commit failed.
+	err = tx.Commit()
+	committed = true
+	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while committing a transaction")
 	}
@@ -425,24 +606,38 @@ func (e *pgStore) EndTrip(ctx context.Context, tripID string, lat, lng float64)
 	locations, err := e.GetLocationsForTrip(ctx, trip.PublicID)
 	if err != nil {
 		return nil, errors.Wrapf(err,
-			"an error occured while fetching locations for trip: %s", trip.ID)
+			"an error occured while fetching locations for trip: %s", trip.PublicID)
 	}
 
 	e.logger.Info("successfully ended trip")
 
-	return &models.Trip{
-		Locations: locations,
+	return fromTrip(*trip, locations), nil
+}
+
+func (e *pgStore) GetLocationsForTrip(ctx context.Context, tripID string) (_ []models.Location, err error) {
+	ctx, span := startSpan(ctx, "GetLocationsForTrip")
+	defer endSpan(span, &err)
 
-		ID:        trip.PublicID,
-		Status:    trip.Status,
-		BikeID:    trip.BikeID,
-		StartedAt: trip.StartedAt,
-		EndedAt:   unwrapNullTime(trip.EndedAt),
-	}, nil
+	locations, err := e.queryLocations(ctx, e.database, tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	count := len(locations)
+
+	correctLocations := make([]models.Location, 0, count)
+	e.logger.Infof("fetched %d location points", count)
+
+	for _, location := range locations {
+		correctLocations = append(correctLocations, location.toModel())
+	}
+
+	return correctLocations, nil
 }
 
-func (e *pgStore) GetLocationsForTrip(ctx context.Context, tripID string) ([]models.Location, error) {
-	rows, err := e.database.Query(listLocationForTrip, tripID)
+// queryLocations returns the locations of a trip ordered by time.
+func (e *pgStore) queryLocations(ctx context.Context, db queryer, tripID string) ([]Location, error) {
+	rows, err := db.QueryContext(ctx, listLocationForTrip, tripID)
 	if err != nil {
 		return nil, errors.Wrap(err,
 			"an error occured while listing trips from the database")
@@ -474,21 +669,85 @@ func (e *pgStore) GetLocationsForTrip(ctx context.Context, tripID string) ([]mod
 			"an error occured during iteration over returned locations")
 	}
 
-	count := len(locations)
+	return locations, nil
+}
 
-	correctLocations := make([]models.Location, count)
-	e.logger.Infof("fetched %d location points", count)
+func (e *pgStore) GetTrip(ctx context.Context, tripID string) (_ *models.Trip, err error) {
+	ctx, span := startSpan(ctx, "GetTrip")
+	defer endSpan(span, &err)
 
-	sort.SliceStable(locations, func(i, j int) bool {
-		return locations[i].CreatedAt.Unix() < locations[j].CreatedAt.Unix()
-	})
+	trip, err := toTrip(e.database.QueryRowContext(ctx, listTrip, tripID))
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while fetching trip: %s", tripID)
+	}
 
-	for _, location := range locations {
-		correctLocations = append(correctLocations,
-			models.CreateLocation(location.Latitude, location.Longitude))
+	locations, err := e.GetLocationsForTrip(ctx, trip.PublicID)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while fetching locations for trip: %s", trip.PublicID)
 	}
 
-	return correctLocations, nil
+	return fromTrip(*trip, locations), nil
+}
+
+func (e *pgStore) ListTripsForBike(ctx context.Context, bikeID, riderID string, cursor string, limit int64) (_ []models.Trip, err error) {
+	ctx, span := startSpan(ctx, "ListTripsForBike")
+	defer endSpan(span, &err)
+
+	return e.listTrips(ctx, bikeID, riderID, time.Time{}, time.Time{}, []int{}, cursor, limit)
+}
+
+func (e *pgStore) ListTrips(ctx context.Context, riderID string, from, to time.Time, statuses []int, cursor string, limit int64) (_ []models.Trip, err error) {
+	ctx, span := startSpan(ctx, "ListTrips")
+	defer endSpan(span, &err)
+
+	return e.listTrips(ctx, "", riderID, from, to, statuses, cursor, limit)
+}
+
+// listTrips lists trips without their locations, newest first.
+// Empty filters match every trip.
+func (e *pgStore) listTrips(ctx context.Context, bikeID, riderID string, from, to time.Time,
+	statuses []int, cursor string, limit int64) ([]models.Trip, error) {
+
+	if statuses == nil {
+		statuses = []int{}
+	}
+
+	rows, err := e.database.QueryContext(ctx, listTrips, bikeID, nullableTime(from), nullableTime(to),
+		pq.Array(statuses), cursor, limit, riderID)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while listing trips from the database")
+	}
+
+	defer func() {
+		thr := rows.Close()
+		if thr != nil {
+			e.logger.WithError(thr).Warn("error while closing trip list query")
+		}
+	}()
+
+	trips := []models.Trip{}
+	for rows.Next() {
+		trip, err := toTrip(rows)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				"an error occured while querying a trip")
+		}
+
+		trips = append(trips, *fromTrip(*trip, nil))
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured during iteration over returned trips")
+	}
+
+	e.logger.Infof("returned %d trips", len(trips))
+
+	return trips, nil
 }
 
 func (e *pgStore) Close(_ context.Context) error {
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/EarvinKayonga/rider/models"
+	"github.com/EarvinKayonga/rider/tracing"
 )
 
 // scannable for scanning rows.
@@ -24,13 +26,33 @@ var (
 	createBike         = `INSERT INTO bikes (public_id, latitude, longitude, status) VALUES ($1, $2, $3, $4) 
 							RETURNING id, public_id, latitude, longitude, status;`
 
-	unlockBikeByPublicID = `UPDATE bikes SET status = 1 
-							WHERE public_id = $1
-							RETURNING id, public_id, latitude, longitude, status;`
+	// updateBikeLocations moves every bike given as parallel arrays.
+	updateBikeLocations = `UPDATE bikes SET latitude = u.latitude, longitude = u.longitude
+							FROM unnest($1::varchar[], $2::real[], $3::real[]) AS u (public_id, latitude, longitude)
+							WHERE bikes.public_id = u.public_id;`
 
-	lockBikeByPublicID = `UPDATE bikes SET status = 0
-							WHERE public_id = $1
+	// setBikeStatus only updates a bike whose current status
+	// may transition to the new one, given as $3.
+	setBikeStatus = `UPDATE bikes SET status = $2
+							WHERE public_id = $1 AND status = ANY($3)
 							RETURNING id, public_id, latitude, longitude, status;`
+
+	// listBikesNear pre-filters bikes within a bounding box,
+	// which is served by bikes_location_idx, before computing
+	// the haversine distance of the remaining ones.
+	listBikesNear = `SELECT id, public_id, latitude, longitude, status, distance FROM (
+							SELECT id, public_id, latitude, longitude, status,
+								2 * $8::double precision * asin(sqrt(least(1,
+									power(sin(radians(latitude - $1::double precision) / 2), 2) +
+									cos(radians($1::double precision)) * cos(radians(latitude)) *
+									power(sin(radians(longitude - $2::double precision) / 2), 2)
+								))) AS distance
+							FROM bikes
+							WHERE latitude BETWEEN $3 AND $4 AND longitude BETWEEN $5 AND $6
+						) AS nearby
+						WHERE distance <= $7
+						ORDER BY distance ASC
+						LIMIT $9;`
 )
 
 // toBike centralizes the parsing of a sql Row to a models.Bike.
@@ -52,27 +74,55 @@ func toBike(row scannable) (*models.Bike, error) {
 
 	return &models.Bike{
 		ID:       publicID,
-		Status:   status,
+		Status:   models.BikeStatus(status),
 		Location: models.CreateLocation(latitude, longitude),
 	}, nil
 }
 
+// toNearbyBike centralizes the parsing of a sql Row to a models.NearbyBike.
+func toNearbyBike(row scannable) (*models.NearbyBike, error) {
+	var publicID string
+	var id int64
+	var status int
+	var latitude, longitude, distance float64
+
+	err := row.Scan(&id, &publicID, &latitude, &longitude, &status, &distance)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			"an error occured while scanning for nearby bike")
+	}
+
+	return &models.NearbyBike{
+		Bike: models.Bike{
+			ID:       publicID,
+			Status:   models.BikeStatus(status),
+			Location: models.CreateLocation(latitude, longitude),
+		},
+		Distance: distance,
+	}, nil
+}
+
 // Location queries.
 var (
-	addLocationToTrip = `INSERT INTO locations (latitude, longitude, trip_id) VALUES ($1, $2, $3) 
-							RETURNING id, latitude, longitude, trip_id, created_at;`
+	addLocationToTrip = `INSERT INTO locations (latitude, longitude, trip_id, recorded_at) VALUES ($1, $2, $3, $4)
+							RETURNING id, latitude, longitude, trip_id, created_at, recorded_at;`
 
-	listLocationForTrip = `SELECT id, latitude, longitude, trip_id, created_at FROM locations WHERE trip_id=$1;`
+	addLocationsToTrips = `INSERT INTO locations (latitude, longitude, trip_id, recorded_at)
+							SELECT * FROM unnest($1::real[], $2::real[], $3::varchar[], $4::timestamptz[]);`
+
+	listLocationForTrip = `SELECT id, latitude, longitude, trip_id, created_at, recorded_at FROM locations
+							WHERE trip_id=$1 ORDER BY COALESCE(recorded_at, created_at), id;`
 )
 
 // toLocation centralizes the parsing of a sql Row to a Location.
 func toLocation(row scannable) (*Location, error) {
 	var tripID string
 	var createdAt time.Time
+	var recordedAt pq.NullTime
 	var id int64
 	var latitude, longitude float64
 
-	err := row.Scan(&id, &latitude, &longitude, &tripID, &createdAt)
+	err := row.Scan(&id, &latitude, &longitude, &tripID, &createdAt, &recordedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrBikeNotFound
@@ -83,23 +133,43 @@ func toLocation(row scannable) (*Location, error) {
 	}
 
 	return &Location{
-		ID:        id,
-		Longitude: longitude,
-		Latitude:  latitude,
-		CreatedAt: createdAt,
-		TripID:    tripID,
+		ID:         id,
+		Longitude:  longitude,
+		Latitude:   latitude,
+		CreatedAt:  createdAt,
+		RecordedAt: recordedAt,
+		TripID:     tripID,
 	}, nil
 }
 
 // Trip queries
 var (
-	createTrip = `INSERT INTO trips (bike_id, public_id , status) VALUES($1, $2, $3)
-					RETURNING id, started_at, ended_at, public_id, bike_id, status;`
+	createTrip = `INSERT INTO trips (bike_id, public_id , status, rider_id) VALUES($1, $2, $3, $4)
+					RETURNING id, started_at, ended_at, public_id, bike_id, status,
+						distance, duration, average_speed, max_speed, rider_id;`
 
-	endTrip = `UPDATE trips SET status = 0,  public_id = $1
-					RETURNING id, started_at, ended_at, public_id, bike_id, status;`
+	endTrip = `UPDATE trips SET status = 0, ended_at = now()
+					WHERE public_id = $1 AND status = 1
+					RETURNING id, started_at, ended_at, public_id, bike_id, status,
+						distance, duration, average_speed, max_speed, rider_id;`
 
-	listTrip = `SELECT id, started_at, ended_at, public_id, bike_id, status FROM trips WHERE public_id=$1;`
+	setTripSummary = `UPDATE trips SET distance = $2, duration = $3, average_speed = $4, max_speed = $5
+					WHERE public_id = $1
+					RETURNING id, started_at, ended_at, public_id, bike_id, status,
+						distance, duration, average_speed, max_speed, rider_id;`
+
+	listTrip = `SELECT id, started_at, ended_at, public_id, bike_id, status,
+						distance, duration, average_speed, max_speed, rider_id FROM trips WHERE public_id=$1;`
+
+	listTrips = `SELECT id, started_at, ended_at, public_id, bike_id, status,
+						distance, duration, average_speed, max_speed, rider_id FROM trips
+					WHERE ($1 = '' OR bike_id = $1)
+					AND ($2::timestamptz IS NULL OR started_at >= $2)
+					AND ($3::timestamptz IS NULL OR started_at < $3)
+					AND (cardinality($4::integer[]) = 0 OR status = ANY($4))
+					AND ($5 = '' OR public_id <= $5)
+					AND ($7 = '' OR rider_id = $7)
+					ORDER BY public_id DESC LIMIT $6;`
 )
 
 // toTrip centralizes the parsing of a sql Row to a Trip.
@@ -109,11 +179,18 @@ func toTrip(row scannable) (*Trip, error) {
 	var endedAt pq.NullTime
 	var id int64
 	var status int
+	var distance, duration, averageSpeed, maxSpeed sql.NullFloat64
+	var riderID sql.NullString
 
-	err := row.Scan(&id, &startedAt, &endedAt, &publicID, &bikeID, &status)
+	err := row.Scan(&id, &startedAt, &endedAt, &publicID, &bikeID, &status,
+		&distance, &duration, &averageSpeed, &maxSpeed, &riderID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTripNotFound
+		}
+
 		return nil, errors.Wrap(err,
-			"an error occured while scanning for location")
+			"an error occured while scanning for trip")
 	}
 
 	return &Trip{
@@ -123,9 +200,44 @@ func toTrip(row scannable) (*Trip, error) {
 		PublicID:  publicID,
 		EndedAt:   endedAt,
 		Status:    status,
+
+		Distance:     distance,
+		Duration:     duration,
+		AverageSpeed: averageSpeed,
+		MaxSpeed:     maxSpeed,
+
+		RiderID: riderID,
 	}, nil
 }
 
+// nullableString converts an empty string to a sql NULL.
+func nullableString(s string) sql.NullString {
+	return sql.NullString{
+		String: s,
+		Valid:  s != "",
+	}
+}
+
+// nullableTime converts a zero time to a sql NULL.
+func nullableTime(t time.Time) pq.NullTime {
+	return pq.NullTime{
+		Time:  t,
+		Valid: !t.IsZero(),
+	}
+}
+
+// activeTripIndex guarantees that a bike has at most one active trip.
+const activeTripIndex = "trips_active_bike_idx"
+
+// uniqueViolation is the postgres error code of unique constraints.
+const uniqueViolation = "23505"
+
+// isUniqueViolation tells whether err comes from the given unique constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	return ok && pqErr.Code == uniqueViolation && pqErr.Constraint == constraint
+}
+
 // unwrapNullTime converts a null time to a time.
 func unwrapNullTime(t pq.NullTime) *time.Time {
 	if t.Valid {
@@ -134,3 +246,19 @@ func unwrapNullTime(t pq.NullTime) *time.Time {
 
 	return nil
 }
+
+// startSpan traces a database operation.
+func startSpan(ctx context.Context, operation string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.StartSpan(ctx, "postgres "+operation, tracing.SpanKindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.operation", operation)
+
+	return ctx, span
+}
+
+// endSpan records a database operation,
+// as failed when it returned an error.
+func endSpan(span *tracing.Span, err *error) {
+	span.SetError(*err)
+	span.End()
+}
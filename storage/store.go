@@ -2,14 +2,38 @@ package storage
 
 import (
 	"context"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
 	"github.com/EarvinKayonga/rider/models"
 )
 
+// NewDatabase returns the Store selected
+// by the configured driver.
+func NewDatabase(ctx context.Context,
+	config configuration.Database, logger logging.Logger) (Store, error) {
+
+	switch config.Driver {
+	case configuration.MemoryDriver:
+		return NewMemoryDatabase(ctx, logger)
+
+	case "", configuration.PostgresDriver:
+		return NewPostgresDatabase(ctx, config, logger)
+
+	default:
+		return nil, errors.Errorf("unknown database driver: %s", config.Driver)
+	}
+}
+
 // Store specifies  how persistance is handled in the app.
 type Store interface {
 	BikeStore
 	TripStore
+	OutboxStore
+	Migrator
 
 	Close(ctx context.Context) error
 }
@@ -21,16 +45,45 @@ type BikeStore interface {
 	ListBikes(ctx context.Context, cursor string, limit int64) ([]models.Bike, error)
 	FindBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error)
 	UpdateBikeLocation(ctx context.Context, bikeID string, lat, lng float64) error
+
+	// UpdateBikeLocations moves bikes in one round trip,
+	// reading only PublicID, Latitude and Longitude.
+	// Unknown bikes are ignored, and the last location of a bike wins.
+	UpdateBikeLocations(ctx context.Context, bikes []Bike) error
+
+	// UnLockBikeByPublicID and LockBikeByPublicID record
+	// a BikeUnlocked or BikeLocked event in the outbox, unlike SetBikeStatus.
 	UnLockBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error)
 	LockBikeByPublicID(ctx context.Context, bikeID string) (*models.Bike, error)
+	SetBikeStatus(ctx context.Context, bikeID string, status models.BikeStatus) (*models.Bike, error)
 	ListAllBikes(ctx context.Context, limit int64) ([]models.Bike, error)
+	ListBikesNear(ctx context.Context, lat, lng, radius float64, limit int64) ([]models.NearbyBike, error)
 }
 
 // TripStore specifies how trip service persisted
 // its data.
 type TripStore interface {
 	GetLocationsForTrip(ctx context.Context, tripID string) ([]models.Location, error)
-	AddLocationToTrip(ctx context.Context, tripID string, lat, lng float64) error
-	CreateTrip(ctx context.Context, bikeID string, lat, lng float64) (*models.Trip, error)
-	EndTrip(ctx context.Context, tripID string, lat, lng float64) (*models.Trip, error)
+	// AddLocationToTrip, CreateTrip and EndTrip take the device time
+	// of the location, zero when unknown.
+	AddLocationToTrip(ctx context.Context, tripID string, lat, lng float64, recordedAt time.Time) error
+
+	// AddLocationsToTrips inserts locations in one round trip,
+	// reading only TripID, Latitude, Longitude and RecordedAt.
+	AddLocationsToTrips(ctx context.Context, locations []Location) error
+
+	// CreateTrip and EndTrip record a TripStarted
+	// or TripEnded event in the outbox.
+	CreateTrip(ctx context.Context, bikeID, riderID string, lat, lng float64, recordedAt time.Time) (*models.Trip, error)
+	EndTrip(ctx context.Context, tripID string, lat, lng float64, recordedAt time.Time) (*models.Trip, error)
+	GetTrip(ctx context.Context, tripID string) (*models.Trip, error)
+
+	// ListTripsForBike and ListTrips only list the trips of riderID,
+	// unless it is empty.
+	ListTripsForBike(ctx context.Context, bikeID, riderID string, cursor string, limit int64) ([]models.Trip, error)
+
+	// ListTrips lists trips started within [from, to), newest first.
+	// A zero from or to leaves the range open,
+	// and empty statuses match every status.
+	ListTrips(ctx context.Context, riderID string, from, to time.Time, statuses []int, cursor string, limit int64) ([]models.Trip, error)
 }
@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/lib/pq"
+
+	"github.com/EarvinKayonga/rider/geo"
+	"github.com/EarvinKayonga/rider/models"
 )
 
 // Location is the database representation of a models.Location.
@@ -12,7 +16,32 @@ type Location struct {
 	Latitude  float64
 	Longitude float64
 	TripID    string
-	CreatedAt time.Time
+
+	// CreatedAt is when the location was received,
+	// RecordedAt when the device recorded it, if it told.
+	CreatedAt  time.Time
+	RecordedAt pq.NullTime
+}
+
+// Time returns when the location was recorded,
+// or received when unknown.
+func (l Location) Time() time.Time {
+	if l.RecordedAt.Valid {
+		return l.RecordedAt.Time
+	}
+
+	return l.CreatedAt
+}
+
+// toModel converts a database location to a models.Location.
+func (l Location) toModel() models.Location {
+	location := models.CreateLocation(l.Latitude, l.Longitude)
+
+	receivedAt := l.CreatedAt
+	location.ReceivedAt = &receivedAt
+	location.RecordedAt = unwrapNullTime(l.RecordedAt)
+
+	return location
 }
 
 // Trip is the database representation of a models.Trip.
@@ -23,13 +52,64 @@ type Trip struct {
 	BikeID    string
 	StartedAt time.Time
 	EndedAt   pq.NullTime
+
+	// summary of the trip, set once ended.
+	// Duration is in seconds.
+	Distance     sql.NullFloat64
+	Duration     sql.NullFloat64
+	AverageSpeed sql.NullFloat64
+	MaxSpeed     sql.NullFloat64
+
+	// RiderID is the rider who started the trip,
+	// NULL for trips started before riders were authenticated.
+	RiderID sql.NullString
 }
 
 // Bike is the database representation of a models.Bike.
 type Bike struct {
 	ID        int64
 	PublicID  string
-	Status    int
+	Status    models.BikeStatus
 	Latitude  float64
 	Longitude float64
 }
+
+// summarize computes the summary of a trip from its locations,
+// ordered by time.
+func (t *Trip) summarize(locations []Location) {
+	points := make([]geo.Point, 0, len(locations))
+	for _, location := range locations {
+		points = append(points, geo.Point{
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			Time:      location.Time(),
+		})
+	}
+
+	summary := geo.Summarize(points)
+
+	t.Distance = sql.NullFloat64{Float64: summary.Distance, Valid: true}
+	t.Duration = sql.NullFloat64{Float64: summary.Duration.Seconds(), Valid: true}
+	t.AverageSpeed = sql.NullFloat64{Float64: summary.AverageSpeed, Valid: true}
+	t.MaxSpeed = sql.NullFloat64{Float64: summary.MaxSpeed, Valid: true}
+}
+
+// lastLocations keeps the last location of every bike,
+// in order of first appearance.
+func lastLocations(bikes []Bike) []Bike {
+	indexes := map[string]int{}
+
+	last := []Bike{}
+	for _, bike := range bikes {
+		index, ok := indexes[bike.PublicID]
+		if ok {
+			last[index] = bike
+			continue
+		}
+
+		indexes[bike.PublicID] = len(last)
+		last = append(last, bike)
+	}
+
+	return last
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/tracing"
+)
+
+// Workflow is the persisted state of a workflow
+// spanning several services.
+type Workflow struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	Step string `json:"step"`
+
+	BikeID     string     `json:"bike_id,omitempty"`
+	TripID     string     `json:"trip_id,omitempty"`
+	Latitude   float64    `json:"latitude"`
+	Longitude  float64    `json:"longitude"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+
+	// RequestID is the id of the request which started the workflow,
+	// and Trace its trace context.
+	RequestID string             `json:"request_id,omitempty"`
+	Trace     tracing.MapCarrier `json:"trace,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WorkflowLog specifies how workflows in progress are persisted.
+type WorkflowLog interface {
+	SaveWorkflow(ctx context.Context, workflow *Workflow) error
+	DeleteWorkflow(ctx context.Context, workflowID string) error
+	ListWorkflows(ctx context.Context) ([]Workflow, error)
+}
+
+// Names of the files of a workflow log.
+const (
+	workflowExtension = ".json"
+
+	// workflowCorruptExtension marks the workflows which could not be read,
+	// any other file being written by a save.
+	workflowCorruptExtension = ".corrupt"
+)
+
+// staleWorkflowTempAge is the age from which a temporary file
+// is left by an interrupted save, rather than a save in progress.
+const staleWorkflowTempAge = time.Minute
+
+// fileWorkflowLog implements WorkflowLog
+// with one file per workflow.
+type fileWorkflowLog struct {
+	directory string
+	logger    logging.Logger
+}
+
+// NewFileWorkflowLog returns a WorkflowLog
+// kept in the given directory.
+func NewFileWorkflowLog(directory string, logger logging.Logger) (WorkflowLog, error) {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while creating workflow directory: %s", directory)
+	}
+
+	return &fileWorkflowLog{
+		directory: directory,
+		logger:    logger,
+	}, nil
+}
+
+// SaveWorkflow writes a workflow atomically,
+// giving it an ID on its first save.
+func (e *fileWorkflowLog) SaveWorkflow(ctx context.Context, workflow *Workflow) error {
+	now := time.Now()
+	if workflow.ID == "" {
+		workflow.ID = ulid.MustNew(ulid.Timestamp(now), rand.Reader).String()
+		workflow.CreatedAt = now
+	}
+
+	workflow.UpdatedAt = now
+
+	content, err := json.Marshal(workflow)
+	if err != nil {
+		return errors.Wrapf(err,
+			"an error occured while marshalling workflow: %s", workflow.ID)
+	}
+
+	file, err := ioutil.TempFile(e.directory, workflow.ID)
+	if err != nil {
+		return errors.Wrapf(err,
+			"an error occured while creating file for workflow: %s", workflow.ID)
+	}
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	thr := file.Close()
+	if err == nil {
+		err = thr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return errors.Wrapf(err,
+			"an error occured while writing workflow: %s", workflow.ID)
+	}
+
+	err = os.Rename(file.Name(), e.path(workflow.ID))
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return errors.Wrapf(err,
+			"an error occured while renaming file of workflow: %s", workflow.ID)
+	}
+
+	return nil
+}
+
+func (e *fileWorkflowLog) DeleteWorkflow(ctx context.Context, workflowID string) error {
+	err := os.Remove(e.path(workflowID))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err,
+			"an error occured while deleting workflow: %s", workflowID)
+	}
+
+	return nil
+}
+
+// ListWorkflows returns the workflows in progress, oldest first.
+// Unreadable workflows are set aside, so that they do not block the others,
+// and the temporary files of interrupted saves are removed.
+func (e *fileWorkflowLog) ListWorkflows(ctx context.Context) ([]Workflow, error) {
+	files, err := ioutil.ReadDir(e.directory)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while listing workflow directory: %s", e.directory)
+	}
+
+	workflows := []Workflow{}
+	for _, file := range files {
+		name := filepath.Join(e.directory, file.Name())
+
+		switch {
+		case file.IsDir(), strings.HasSuffix(file.Name(), workflowCorruptExtension):
+			continue
+
+		case !strings.HasSuffix(file.Name(), workflowExtension):
+			if time.Since(file.ModTime()) < staleWorkflowTempAge {
+				continue
+			}
+
+			err = os.Remove(name)
+			if err != nil && !os.IsNotExist(err) {
+				e.logger.WithError(err).Warnf("error while removing stale workflow file: %s", file.Name())
+				continue
+			}
+
+			e.logger.Warnf("removed workflow file of an interrupted save: %s", file.Name())
+			continue
+		}
+
+		workflow, err := readWorkflow(name)
+		if err != nil {
+			e.logger.WithError(err).Errorf("setting aside unreadable workflow file: %s", file.Name())
+
+			err = os.Rename(name, name+workflowCorruptExtension)
+			if err != nil {
+				e.logger.WithError(err).Errorf("error while setting aside workflow file: %s", file.Name())
+			}
+
+			continue
+		}
+
+		workflows = append(workflows, *workflow)
+	}
+
+	return workflows, nil
+}
+
+// readWorkflow reads the workflow of a file.
+func readWorkflow(name string) (*Workflow, error) {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while reading workflow file: %s", name)
+	}
+
+	workflow := &Workflow{}
+	err = json.Unmarshal(content, workflow)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"an error occured while unmarshalling workflow file: %s", name)
+	}
+
+	return workflow, nil
+}
+
+func (e *fileWorkflowLog) path(workflowID string) string {
+	return filepath.Join(e.directory, workflowID+workflowExtension)
+}
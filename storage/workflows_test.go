@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+)
+
+func exists(t *testing.T, path string) bool {
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	return err == nil
+}
+
+func TestListWorkflows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workflows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	workflows, err := NewFileWorkflowLog(dir, *logging.NewLogger(configuration.Logging{Level: "error"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bikeID := range []string{"bike-1", "bike-2"} {
+		// ids are ordered by the millisecond of their creation.
+		time.Sleep(2 * time.Millisecond)
+
+		err = workflows.SaveWorkflow(ctx, &Workflow{Kind: "start_trip", BikeID: bikeID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a corrupt workflow, and the temporary files of an interrupted save
+	// and of a save in progress.
+	corrupt := filepath.Join(dir, "corrupt"+workflowExtension)
+	stale := filepath.Join(dir, "stale123")
+	fresh := filepath.Join(dir, "fresh456")
+
+	for path, content := range map[string]string{corrupt: `{"id":`, stale: `{}`, fresh: `{}`} {
+		err = ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := time.Now().Add(-2 * staleWorkflowTempAge)
+	err = os.Chtimes(stale, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := workflows.ListWorkflows(ctx)
+	if err != nil {
+		t.Fatalf("expected the readable workflows to be listed, got %v", err)
+	}
+
+	if len(listed) != 2 || listed[0].BikeID != "bike-1" || listed[1].BikeID != "bike-2" {
+		t.Fatalf("expected the 2 saved workflows, got %v", listed)
+	}
+
+	if exists(t, corrupt) || !exists(t, corrupt+workflowCorruptExtension) {
+		t.Fatal("expected the corrupt workflow to be set aside")
+	}
+
+	if exists(t, stale) || !exists(t, fresh) {
+		t.Fatal("expected only the stale temporary file to be removed")
+	}
+
+	// the set aside workflow is not read again.
+	listed, err = workflows.ListWorkflows(ctx)
+	if err != nil || len(listed) != 2 {
+		t.Fatalf("expected the 2 saved workflows, got %v, %v", listed, err)
+	}
+}
@@ -0,0 +1,234 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Exporter sends finished spans to a backend.
+type Exporter interface {
+	Export(spans []SpanData) error
+}
+
+// stdoutExporter writes spans as JSON lines.
+type stdoutExporter struct {
+	service string
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewStdoutExporter returns an Exporter writing
+// one JSON object per span to w.
+func NewStdoutExporter(w io.Writer, service string) Exporter {
+	return &stdoutExporter{
+		service: service,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (e *stdoutExporter) Export(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, span := range spans {
+		err := e.encoder.Encode(struct {
+			Service string `json:"service"`
+			SpanData
+		}{
+			Service:  e.service,
+			SpanData: span,
+		})
+		if err != nil {
+			return errors.Wrap(err, "an error occured while encoding span")
+		}
+	}
+
+	return nil
+}
+
+// otlpExporter posts spans to an OpenTelemetry collector,
+// with the JSON encoding of OTLP/HTTP.
+type otlpExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// NewOTLPExporter returns an Exporter posting spans to the
+// OTLP/HTTP endpoint of a collector, such as http://localhost:4318.
+func NewOTLPExporter(endpoint, service string) Exporter {
+	return &otlpExporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service: service,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (e *otlpExporter) Export(spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return errors.Wrap(err, "an error occured while encoding spans")
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "an error occured while posting spans to %s", e.url)
+	}
+
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("collector at %s answered %s", e.url, resp.Status)
+	}
+
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	TraceState        string          `json:"traceState,omitempty"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpLink struct {
+	TraceID    string `json:"traceId"`
+	SpanID     string `json:"spanId"`
+	TraceState string `json:"traceState,omitempty"`
+}
+
+// Status codes of OTLP.
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (e *otlpExporter) request(spans []SpanData) otlpRequest {
+	resource := otlpResourceSpans{}
+	resource.Resource.Attributes = []otlpAttribute{
+		newOTLPAttribute("service.name", e.service),
+	}
+
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "github.com/EarvinKayonga/rider/tracing"
+
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.Context.TraceID.String(),
+			SpanID:            span.Context.SpanID.String(),
+			TraceState:        span.Context.TraceState,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Status: otlpStatus{
+				Code: otlpStatusOK,
+			},
+		}
+
+		if span.ParentSpanID.IsValid() {
+			s.ParentSpanID = span.ParentSpanID.String()
+		}
+
+		for k, v := range span.Attributes {
+			s.Attributes = append(s.Attributes, newOTLPAttribute(k, v))
+		}
+
+		for _, link := range span.Links {
+			s.Links = append(s.Links, otlpLink{
+				TraceID:    link.TraceID.String(),
+				SpanID:     link.SpanID.String(),
+				TraceState: link.TraceState,
+			})
+		}
+
+		if span.Error != "" {
+			s.Status = otlpStatus{
+				Code:    otlpStatusError,
+				Message: span.Error,
+			}
+		}
+
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	resource.ScopeSpans = []otlpScopeSpans{scope}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{resource},
+	}
+}
+
+func newOTLPAttribute(key string, value interface{}) otlpAttribute {
+	var v map[string]interface{}
+	switch value := value.(type) {
+	case string:
+		v = map[string]interface{}{"stringValue": value}
+	case bool:
+		v = map[string]interface{}{"boolValue": value}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		v = map[string]interface{}{"doubleValue": value}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+
+	return otlpAttribute{
+		Key:   key,
+		Value: v,
+	}
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// W3C trace context headers.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+const (
+	traceParentVersion = "00"
+	sampledFlag        = 0x01
+)
+
+// Carrier holds propagated fields, such as http.Header.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// MapCarrier is a Carrier to embed in messages.
+type MapCarrier map[string]string
+
+// Get returns the value of key.
+func (m MapCarrier) Get(key string) string {
+	return m[key]
+}
+
+// Set sets the value of key.
+func (m MapCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+// Inject writes the span context of ctx into carrier.
+func Inject(ctx context.Context, carrier Carrier) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	flags := 0
+	if sc.Sampled {
+		flags = sampledFlag
+	}
+
+	carrier.Set(TraceParentHeader, fmt.Sprintf("%s-%s-%s-%02x",
+		traceParentVersion, sc.TraceID, sc.SpanID, flags))
+
+	if sc.TraceState != "" {
+		carrier.Set(TraceStateHeader, sc.TraceState)
+	}
+}
+
+// Extract returns a context whose next span continues
+// the span context found in carrier, if any.
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	sc, ok := ParseSpanContext(carrier)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// ParseSpanContext reads the span context found in carrier.
+func ParseSpanContext(carrier Carrier) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(carrier.Get(TraceParentHeader)), "-")
+
+	// later versions may add fields.
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == traceParentVersion && len(parts) != 4) {
+
+		return SpanContext{}, false
+	}
+
+	sc := SpanContext{}
+	if !decodeHex(parts[1], sc.TraceID[:]) || !decodeHex(parts[2], sc.SpanID[:]) {
+		return SpanContext{}, false
+	}
+
+	flags := [1]byte{}
+	if !decodeHex(parts[3], flags[:]) || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+
+	sc.Sampled = flags[0]&sampledFlag != 0
+	sc.TraceState = carrier.Get(TraceStateHeader)
+
+	return sc, true
+}
+
+// decodeHex decodes exactly len(dst) lowercase hexadecimal bytes.
+func decodeHex(src string, dst []byte) bool {
+	if len(src) != hex.EncodedLen(len(dst)) || strings.ToLower(src) != src {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// SpanKind tells the role of a span in a trace,
+// with the values of OpenTelemetry.
+type SpanKind int
+
+// Kinds of span.
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// IsValid tells whether the id is not zero.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// MarshalText encodes the id in hexadecimal, a zero id being empty.
+func (t TraceID) MarshalText() ([]byte, error) {
+	if !t.IsValid() {
+		return []byte{}, nil
+	}
+
+	return []byte(t.String()), nil
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// IsValid tells whether the id is not zero.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// MarshalText encodes the id in hexadecimal, a zero id being empty.
+func (s SpanID) MarshalText() ([]byte, error) {
+	if !s.IsValid() {
+		return []byte{}, nil
+	}
+
+	return []byte(s.String()), nil
+}
+
+// SpanContext is the part of a span propagated
+// across services.
+type SpanContext struct {
+	TraceID    TraceID `json:"trace_id"`
+	SpanID     SpanID  `json:"span_id"`
+	Sampled    bool    `json:"sampled"`
+	TraceState string  `json:"trace_state,omitempty"`
+}
+
+// IsValid tells whether both ids are set.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.IsValid() && c.SpanID.IsValid()
+}
+
+// SpanData is a finished span, as handed to exporters.
+type SpanData struct {
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	Context      SpanContext            `json:"context"`
+	ParentSpanID SpanID                 `json:"parent_span_id,omitempty"`
+	Start        time.Time              `json:"start"`
+	End          time.Time              `json:"end"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Links        []SpanContext          `json:"links,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// Span times an operation.
+// A nil Span is valid and records nothing,
+// so that code runs the same without a tracer.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Context returns the span context to propagate.
+func (e *Span) Context() SpanContext {
+	if e == nil {
+		return SpanContext{}
+	}
+
+	return e.data.Context
+}
+
+// SetAttribute describes the operation.
+func (e *Span) SetAttribute(key string, value interface{}) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.data.Attributes == nil {
+		e.data.Attributes = map[string]interface{}{}
+	}
+
+	e.data.Attributes[key] = value
+}
+
+// AddLink relates the span to a span of another trace,
+// such as a message handled in a batch.
+func (e *Span) AddLink(link SpanContext) {
+	if e == nil || !link.IsValid() {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.data.Links = append(e.data.Links, link)
+}
+
+// SetError marks the operation as failed, a nil error being ignored.
+func (e *Span) SetError(err error) {
+	if e == nil || err == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.data.Error = err.Error()
+}
+
+// End records the span, once.
+func (e *Span) End() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	if e.ended {
+		e.mu.Unlock()
+		return
+	}
+
+	e.ended = true
+	e.data.End = time.Now()
+	data := e.data
+	// the exporters read the attributes after the lock is released.
+	data.Attributes = make(map[string]interface{}, len(e.data.Attributes))
+	for key, value := range e.data.Attributes {
+		data.Attributes[key] = value
+	}
+	e.mu.Unlock()
+
+	if data.Context.Sampled {
+		e.tracer.record(data)
+	}
+}
@@ -0,0 +1,257 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	"math/big"
+	insecure "math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/logging"
+)
+
+// keyType is a package local type alias purposed to avoid name collision
+// in context.
+type keyType string
+
+const (
+	key       = keyType("tracing")
+	spanKey   = keyType("span")
+	remoteKey = keyType("remote")
+)
+
+// Tracer starts spans and hands the finished ones
+// to an exporter, by batches.
+type Tracer struct {
+	exporter  Exporter
+	ratio     float64
+	batchSize int
+	interval  time.Duration
+	logger    logging.Logger
+
+	spans chan SpanData
+	flush chan chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewTracer returns a Tracer exporting the spans of service
+// as configured. Without exporter, spans are only propagated.
+func NewTracer(service string, conf configuration.Tracing, logger logging.Logger) (*Tracer, error) {
+	var exporter Exporter
+	switch conf.Exporter {
+	case "", configuration.NoExporter:
+	case configuration.StdoutExporter:
+		exporter = NewStdoutExporter(os.Stdout, service)
+	case configuration.OTLPExporter:
+		exporter = NewOTLPExporter(conf.Endpoint, service)
+	default:
+		return nil, errors.Errorf("unknown trace exporter: %s", conf.Exporter)
+	}
+
+	batchSize := conf.BatchSize
+	if batchSize <= 0 {
+		batchSize = configuration.DefaultTracing.BatchSize
+	}
+
+	interval := conf.FlushInterval
+	if interval <= 0 {
+		interval = configuration.DefaultTracing.FlushInterval
+	}
+
+	tracer := &Tracer{
+		exporter:  exporter,
+		ratio:     conf.SampleRatio,
+		batchSize: batchSize,
+		interval:  interval,
+		logger:    logger,
+
+		spans: make(chan SpanData, 4*batchSize),
+		flush: make(chan chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	if exporter != nil {
+		go tracer.run()
+	}
+
+	return tracer, nil
+}
+
+// Close exports the pending spans.
+func (e *Tracer) Close(ctx context.Context) error {
+	if e == nil || e.exporter == nil {
+		return nil
+	}
+
+	e.once.Do(func() {
+		defer close(e.done)
+
+		flushed := make(chan struct{})
+		select {
+		case e.flush <- flushed:
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+		}
+	})
+
+	return ctx.Err()
+}
+
+// record queues a finished span,
+// dropping it when the exporter lags behind.
+func (e *Tracer) record(span SpanData) {
+	if e == nil || e.exporter == nil {
+		return
+	}
+
+	select {
+	case e.spans <- span:
+	default:
+		e.logger.Debugf("dropped span %s, export queue is full", span.Name)
+	}
+}
+
+func (e *Tracer) run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, e.batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := e.exporter.Export(batch)
+		if err != nil {
+			e.logger.WithError(err).Warnf("an error occured while exporting %d spans", len(batch))
+		}
+
+		batch = make([]SpanData, 0, e.batchSize)
+	}
+
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				export()
+			}
+
+		case <-ticker.C:
+			export()
+
+		case flushed := <-e.flush:
+			for len(e.spans) > 0 {
+				batch = append(batch, <-e.spans)
+			}
+
+			export()
+			close(flushed)
+
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// sampled decides whether a new trace is exported.
+func (e *Tracer) sampled() bool {
+	if e.exporter == nil || e.ratio <= 0 {
+		return false
+	}
+
+	if e.ratio >= 1 {
+		return true
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+	if err != nil {
+		return false
+	}
+
+	return float64(n.Int64())/math.MaxInt64 < e.ratio
+}
+
+// StartSpan starts a span, child of the span of ctx
+// or of the span context extracted into it.
+// Without a Tracer in ctx, the span is nil.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	tracer, ok := ctx.Value(key).(*Tracer)
+	if !ok || tracer == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer: tracer,
+		data: SpanData{
+			Name:  name,
+			Kind:  kind,
+			Start: time.Now(),
+		},
+	}
+
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() {
+		span.data.Context.TraceID = parent.TraceID
+		span.data.Context.Sampled = parent.Sampled
+		span.data.Context.TraceState = parent.TraceState
+		span.data.ParentSpanID = parent.SpanID
+	} else {
+		randomID(span.data.Context.TraceID[:])
+		span.data.Context.Sampled = tracer.sampled()
+	}
+
+	randomID(span.data.Context.SpanID[:])
+
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// SpanFromContext returns the span of ctx, nil when there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the span context to continue:
+// the one of the span of ctx, or the one extracted into it.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context()
+	}
+
+	sc, _ := ctx.Value(remoteKey).(SpanContext)
+	return sc
+}
+
+// NewContext adds the given Tracer to the Context.
+func NewContext(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, key, tracer)
+}
+
+// randomID fills id with random bytes, not all zero.
+func randomID(id []byte) {
+	for {
+		_, err := rand.Read(id)
+		if err != nil {
+			_, _ = insecure.Read(id)
+		}
+
+		for _, b := range id {
+			if b != 0 {
+				return
+			}
+		}
+	}
+}
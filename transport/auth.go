@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/EarvinKayonga/rider/auth"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/tracing"
+)
+
+// bearerPrefix prefixes the token in the Authorization header.
+const bearerPrefix = "Bearer "
+
+// authenticated only hands to handler the requests
+// bearing a valid token, with the rider in their context.
+func authenticated(verifier *auth.Verifier, logger logging.Logger,
+	handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req == nil {
+			handler(w, req)
+			return
+		}
+
+		ctx := req.Context()
+
+		token, err := bearerToken(req)
+		if err == nil {
+			var claims *auth.Claims
+			claims, err = verifier.Verify(token)
+			if err == nil {
+				tracing.SpanFromContext(ctx).SetAttribute("rider_id", claims.Subject)
+				handler(w, req.WithContext(auth.NewContext(ctx, claims.Subject)))
+				return
+			}
+		}
+
+		logger.WithContext(ctx).WithError(err).Info("rejecting an unauthenticated request")
+		Erroring(ctx, w, err, logger)
+	}
+}
+
+// bearerToken reads the token of the Authorization header.
+func bearerToken(req *http.Request) (string, error) {
+	header := req.Header.Get("Authorization")
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", auth.ErrMissingToken
+	}
+
+	token := strings.TrimSpace(header[len(bearerPrefix):])
+	if token == "" {
+		return "", auth.ErrMissingToken
+	}
+
+	return token, nil
+}
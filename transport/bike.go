@@ -13,6 +13,7 @@ import (
 	"github.com/EarvinKayonga/rider/domain"
 	"github.com/EarvinKayonga/rider/logging"
 	"github.com/EarvinKayonga/rider/stats"
+	"github.com/EarvinKayonga/rider/validation"
 )
 
 // NewBikeService returns the bike service wrapped in a valid http.Server.
@@ -31,7 +32,7 @@ func NewBikeService(
 		return nil, errors.Wrap(err, "cannot register routes for bike service")
 	}
 
-	securedRouter := secureHeaders(router)
+	securedRouter := secureHeaders(withRequestID(ctx, router))
 	return NewServer(ctx, conf.Server, securedRouter)
 }
 
@@ -44,10 +45,12 @@ func registerRoutesForBikeService(
 	statter stats.Statter) error {
 
 	router.HandleFunc("/health", health(ctx, metadata)).Methods("GET")
-	router.HandleFunc("/bike/{bikeID}", GetBikeByID(ctx, conf, logger, statter)).Methods("GET")
-	router.HandleFunc("/lock/{bikeID}", LockBikeByID(ctx, conf, logger, statter)).Methods("GET")
-	router.HandleFunc("/unlock/{bikeID}", UnLockBikeByID(ctx, conf, logger, statter)).Methods("GET")
-	router.HandleFunc("/bikes", ListOfBikes(ctx, conf, logger, statter)).Methods("GET")
+	router.HandleFunc("/bike/{bikeID}", withRoute(ctx, conf.Server, "bike", GetBikeByID(ctx, conf, logger, statter))).Methods("GET")
+	router.HandleFunc("/lock/{bikeID}", withRoute(ctx, conf.Server, "lock", LockBikeByID(ctx, conf, logger, statter))).Methods("GET")
+	router.HandleFunc("/unlock/{bikeID}", withRoute(ctx, conf.Server, "unlock", UnLockBikeByID(ctx, conf, logger, statter))).Methods("GET")
+	router.HandleFunc("/bike/{bikeID}/status", withRoute(ctx, conf.Server, "bike_status", SetBikeStatus(ctx, conf, logger, statter))).Methods("PUT")
+	router.HandleFunc("/bikes", withRoute(ctx, conf.Server, "bikes", ListOfBikes(ctx, conf, logger, statter))).Methods("GET")
+	router.HandleFunc("/bikes/near", withRoute(ctx, conf.Server, "bikes_near", ListBikesNear(ctx, conf, logger, statter))).Methods("GET")
 
 	return nil
 }
@@ -71,7 +74,20 @@ func ListOfBikes(ctx context.Context,
 			return
 		}
 
-		cursor, limit := GetPaginationArguments(req)
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		cursor, limit, err := GetPaginationArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.bikes.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading pagination arguments")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
 		bikes, err := domain.ListOfBikes(ctx, cursor, limit)
 		if err != nil {
 			defer func() {
@@ -98,6 +114,65 @@ func ListOfBikes(ctx context.Context,
 	}
 }
 
+// ListBikesNear returns the bikes around a location, closest first.
+func ListBikesNear(ctx context.Context,
+	conf configuration.BikeConfiguration,
+	logger logging.Logger,
+	statter stats.Statter,
+) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		defer func() {
+			_ = statter.TimingDuration("list.bikes.near.timing", time.Since(start), 1.0)
+			_ = statter.Inc("list.bikes.near.request", 1, 1.0)
+		}()
+
+		if req == nil {
+			logger.Error("received an empty request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		lat, lng, radius, limit, err := GetNearbyArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.bikes.near.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading nearby arguments")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		bikes, err := domain.ListBikesNear(ctx, lat, lng, radius, limit)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.bikes.near.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while fetching nearby bikes")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(bikes)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.bikes.near.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while rendering nearby bikes")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		logger.Info("nearby bikes successfully rendered")
+	}
+}
+
 // GetBikeByID returns a bike given an ID.
 func GetBikeByID(ctx context.Context,
 	conf configuration.BikeConfiguration,
@@ -116,6 +191,9 @@ func GetBikeByID(ctx context.Context,
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		params := mux.Vars(req)
 		bikeID := params["bikeID"]
 
@@ -162,6 +240,9 @@ func LockBikeByID(ctx context.Context,
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		params := mux.Vars(req)
 		bikeID := params["bikeID"]
 
@@ -208,6 +289,9 @@ func UnLockBikeByID(ctx context.Context,
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		params := mux.Vars(req)
 		bikeID := params["bikeID"]
 
@@ -235,3 +319,69 @@ func UnLockBikeByID(ctx context.Context,
 		logger.Info("unlocked bike successfully rendered")
 	}
 }
+
+// SetBikeStatus moves a bike to the status given in the body.
+func SetBikeStatus(ctx context.Context,
+	conf configuration.BikeConfiguration,
+	logger logging.Logger,
+	statter stats.Statter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		defer func() {
+			_ = statter.TimingDuration("bike.status.timing", time.Since(start), 1.0)
+			_ = statter.Inc("bike.status.request", 1, 1.0)
+		}()
+
+		if req == nil {
+			logger.Error("received an empty request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		defer func() {
+			_ = req.Body.Close()
+		}()
+
+		params := mux.Vars(req)
+		bikeID := params["bikeID"]
+
+		payload := domain.BikeStatusPayload{}
+
+		err := validation.Decode(req, &payload)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("bike.status.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while unmarshalling status payload")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		bike, err := domain.SetBikeStatus(ctx, bikeID, *payload.Status)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("bike.status.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while changing bike status")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(bike)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("bike.status.error", 1, 1.0)
+			}()
+
+			Erroring(ctx, w, err, logger)
+			logger.WithError(err).Error("an error occuring while rendering bike")
+		}
+
+		logger.Infof("bike successfully moved to %s", *payload.Status)
+	}
+}
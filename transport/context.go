@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/entropy"
+	"github.com/EarvinKayonga/rider/httpx"
+	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/tracing"
+)
+
+// maxRequestIDLength bounds the request ids accepted from clients.
+const maxRequestIDLength = 128
+
+// requestContext is canceled with a request,
+// while carrying the values of the service context
+// such as its stores and clients.
+type requestContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c requestContext) Value(key interface{}) interface{} {
+	if value := c.Context.Value(key); value != nil {
+		return value
+	}
+
+	return c.values.Value(key)
+}
+
+// withRoute hands a request context to handler,
+// bounded by the timeout configured for route,
+// and traces the request as a span named after route.
+func withRoute(ctx context.Context, conf configuration.Server,
+	route string, handler http.HandlerFunc) http.HandlerFunc {
+
+	timeout := conf.TimeoutFor(route)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req == nil {
+			handler(w, req)
+			return
+		}
+
+		var reqCtx context.Context = requestContext{
+			Context: req.Context(),
+			values:  ctx,
+		}
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			reqCtx, cancel = context.WithTimeout(reqCtx, timeout)
+			defer cancel()
+		}
+
+		reqCtx, span := tracing.StartSpan(tracing.Extract(reqCtx, req.Header),
+			req.Method+" "+route, tracing.SpanKindServer)
+		defer span.End()
+
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", req.URL.EscapedPath())
+		span.SetAttribute("request_id", logging.RequestIDFromContext(reqCtx))
+
+		recorder := &statusRecorder{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+
+		handler(recorder, req.WithContext(reqCtx))
+
+		span.SetAttribute("http.status_code", recorder.status)
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(recorder.status)))
+		}
+	}
+}
+
+// statusRecorder keeps the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestID stores the request id sent by the client,
+// or a new one from the generator of ctx, in the request context
+// and echoes it in the response.
+func withRequestID(ctx context.Context, next http.Handler) http.Handler {
+	ids := entropy.FromContext(ctx)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(httpx.RequestIDHeader)
+		if !validRequestID(id) {
+			id = ids.NewID()
+		}
+
+		w.Header().Set(httpx.RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(logging.NewRequestIDContext(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts short ids of printable characters,
+// so that they can be logged and forwarded as is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -2,41 +2,69 @@ package transport
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/auth"
 	"github.com/EarvinKayonga/rider/domain"
+	"github.com/EarvinKayonga/rider/httpx"
 	"github.com/EarvinKayonga/rider/logging"
-	"github.com/EarvinKayonga/rider/storage"
+	"github.com/EarvinKayonga/rider/problem"
 )
 
-// Erroring centralize the error handling on the transport layer.
-func Erroring(_ context.Context, w http.ResponseWriter, err error, logger logging.Logger) {
-	switch err {
-	case domain.ErrBikeInUse:
-		w.WriteHeader(http.StatusBadRequest)
-		err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "bike already in use",
-		})
-		if err != nil {
-			logger.WithError(err).Info("while json encoding a error")
-		}
-
-	case storage.ErrBikeNotFound:
-		w.WriteHeader(http.StatusNotFound)
-		err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "bike not found",
-		})
-		if err != nil {
-			logger.WithError(err).Info("while json encoding a error")
-		}
-
-	default:
-		w.WriteHeader(http.StatusInternalServerError)
-		_, err := fmt.Fprint(w, "an expected error occured :(")
-		if err != nil {
-			logger.WithError(err).Info("while json encoding a error")
-		}
+// Erroring centralize the error handling on the transport layer,
+// rendering errors as problem details.
+func Erroring(ctx context.Context, w http.ResponseWriter, err error, logger logging.Logger) {
+	known := problemOf(ctx, w, err)
+
+	err = problem.Write(w, problem.From(known, logging.RequestIDFromContext(ctx)))
+	if err != nil {
+		logger.WithError(err).Info("while json encoding a error")
+	}
+}
+
+// problemOf returns the known error behind err, setting
+// the response headers it comes with.
+func problemOf(ctx context.Context, w http.ResponseWriter, err error) *problem.Error {
+	if isTimeout(ctx, err) {
+		return domain.ErrTimeout
+	}
+
+	if open, ok := httpx.IsCircuitOpen(err); ok {
+		w.Header().Set("Retry-After", strconv.FormatInt(open.RetryAfterSeconds(), 10))
+		return domain.ErrUnavailable.WithDetail(open.Upstream + " service unavailable")
+	}
+
+	known, ok := errors.Cause(err).(*problem.Error)
+	if !ok {
+		return domain.ErrUnexpected
 	}
+
+	switch known {
+	case auth.ErrMissingToken:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	case auth.ErrInvalidToken, auth.ErrExpiredToken:
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+
+	return known
+}
+
+// isTimeout tells whether err comes from the deadline
+// of the request or of an upstream call.
+func isTimeout(ctx context.Context, err error) bool {
+	if ctx.Err() == context.DeadlineExceeded {
+		return true
+	}
+
+	cause := errors.Cause(err)
+	if cause == context.DeadlineExceeded {
+		return true
+	}
+
+	urlErr, ok := cause.(*url.Error)
+	return ok && urlErr.Timeout()
 }
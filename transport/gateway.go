@@ -9,12 +9,15 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 
+	"github.com/EarvinKayonga/rider/auth"
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/domain"
 	"github.com/EarvinKayonga/rider/httpx"
 	"github.com/EarvinKayonga/rider/logging"
 	"github.com/EarvinKayonga/rider/messaging"
 	"github.com/EarvinKayonga/rider/stats"
+	"github.com/EarvinKayonga/rider/storage"
+	"github.com/EarvinKayonga/rider/validation"
 )
 
 // NewGatewayService returns the gateway service wrapped in a valid http.Server.
@@ -24,19 +27,23 @@ func NewGatewayService(
 	conf configuration.GatewayConfiguration,
 	logger logging.Logger,
 	statter stats.Statter,
-	messenger messaging.Emitter) (*http.Server, error) {
+	messenger messaging.Emitter,
+	workflows storage.WorkflowLog) (*http.Server, error) {
 
 	router := mux.NewRouter()
 	router.StrictSlash(true)
 
-	limiter := httpx.Limiter(conf.Limiter.Limit, conf.Limiter.Burst)
-	err := registerRoutesForGatewayService(ctx, router, m, conf, logger, statter, messenger)
+	verifier, err := auth.NewVerifier(conf.Auth)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create token verifier for gateway service")
+	}
+
+	err = registerRoutesForGatewayService(ctx, router, m, conf, logger, statter, messenger, workflows, verifier)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot register routes for gateway service")
 	}
 
-	limitedRouter := limiter(router)
-	securedRouter := secureHeaders(limitedRouter)
+	securedRouter := secureHeaders(withRequestID(ctx, router))
 
 	return NewServer(ctx, conf.Server, securedRouter)
 }
@@ -48,15 +55,49 @@ func registerRoutesForGatewayService(
 	conf configuration.GatewayConfiguration,
 	logger logging.Logger,
 	statter stats.Statter,
-	messenger messaging.Emitter) error {
+	messenger messaging.Emitter,
+	workflows storage.WorkflowLog,
+	verifier *auth.Verifier) error {
+
+	riders := domain.NewTripRiders(domain.DefaultTripRidersSize)
+	limiter := httpx.NewRateLimiter(conf.Limiter)
+	unauthenticated := httpx.NewRateLimiter(configuration.Limiter{
+		Limit: conf.Limiter.Unauthenticated.Limit,
+		Burst: conf.Limiter.Unauthenticated.Burst,
+		Size:  conf.Limiter.Size,
+	})
+
+	clients, err := newClients(conf.Limiter)
+	if err != nil {
+		return errors.Wrap(err, "an error occured while reading rate limited clients")
+	}
+
+	// route limits the rate of the clients of a route, and riderRoute
+	// of the clients it authenticates: by rider once their token is verified
+	// when so configured, by ip under a policy of its own before that.
+	route := func(name string, handler http.HandlerFunc) http.HandlerFunc {
+		return withRoute(ctx, conf.Server, name,
+			rateLimited(limiter, clients, logger, name, handler))
+	}
+	riderRoute := func(name string, handler http.HandlerFunc) http.HandlerFunc {
+		if conf.Limiter.Key != configuration.LimiterKeyRider {
+			return route(name, authenticated(verifier, logger, handler))
+		}
+
+		return withRoute(ctx, conf.Server, name, ipLimited(unauthenticated, clients, logger,
+			authenticated(verifier, logger, rateLimited(limiter, clients, logger, name, handler))))
+	}
 
-	router.HandleFunc("/health", health(ctx, metadata))
+	router.HandleFunc("/health", rateLimited(limiter, clients, logger, "health", health(ctx, metadata)))
 
-	router.HandleFunc("/bike/{bikeID}", GatewayGetBikeByID(ctx, conf, logger, statter))
-	router.HandleFunc("/bikes", GatewayListOfBikes(ctx, conf, logger, statter))
-	router.HandleFunc("/trip/track", TrackTrip(ctx, conf, logger, statter, messenger))
-	router.HandleFunc("/trip/start", GatewayStartTrip(ctx, conf, logger, statter))
-	router.HandleFunc("/trip/end", GatewayEndTrip(ctx, conf, logger, statter))
+	router.HandleFunc("/bike/{bikeID}", route("bike", GatewayGetBikeByID(ctx, conf, logger, statter)))
+	router.HandleFunc("/bikes", route("bikes", GatewayListOfBikes(ctx, conf, logger, statter)))
+	router.HandleFunc("/bikes/near", route("bikes_near", GatewayListBikesNear(ctx, conf, logger, statter)))
+	router.HandleFunc("/trip/track", riderRoute("trip_track", TrackTrip(ctx, conf, logger, statter, messenger, riders)))
+	router.HandleFunc("/trip/start", riderRoute("trip_start", GatewayStartTrip(ctx, conf, logger, statter, workflows)))
+	router.HandleFunc("/trip/end", riderRoute("trip_end", GatewayEndTrip(ctx, conf, logger, statter, workflows, riders)))
+	router.HandleFunc("/trip/{tripID}", riderRoute("trip", GatewayGetTrip(ctx, conf, logger, statter, riders)))
+	router.HandleFunc("/trips", riderRoute("trips", GatewayListTrips(ctx, conf, logger, statter)))
 
 	return nil
 }
@@ -79,7 +120,26 @@ func GatewayGetBikeByID(ctx context.Context,
 			return
 		}
 
-		bike, err := domain.GatewayGetBikeByID(ctx, conf, mux.Vars(req)["bikeID"])
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		bikeID := mux.Vars(req)["bikeID"]
+
+		v := validation.Parameters()
+		v.Identifier("bikeID", bikeID, true, domain.IsValidBikeID)
+
+		err := v.Err()
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.bike.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading bike id")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		bike, err := domain.GatewayGetBikeByID(ctx, conf, bikeID)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("gateway.bike.error", 1, 1.0)
@@ -123,7 +183,20 @@ func GatewayListOfBikes(ctx context.Context,
 			return
 		}
 
-		cursor, limit := GetPaginationArguments(req)
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		cursor, limit, err := GetPaginationArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.bikes.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading pagination arguments")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
 		bikes, err := domain.GatewayListOfBikes(ctx, conf, cursor, limit)
 		if err != nil {
 			defer func() {
@@ -150,12 +223,72 @@ func GatewayListOfBikes(ctx context.Context,
 	}
 }
 
+// GatewayListBikesNear returns the bikes around a location, closest first.
+func GatewayListBikesNear(ctx context.Context,
+	conf configuration.GatewayConfiguration,
+	logger logging.Logger,
+	statter stats.Statter,
+) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		defer func() {
+			_ = statter.TimingDuration("gateway.list.bikes.near.timing", time.Since(start), 1.0)
+			_ = statter.Inc("gateway.list.bikes.near.request", 1, 1.0)
+		}()
+
+		if req == nil {
+			logger.Error("received an empty request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		lat, lng, radius, limit, err := GetNearbyArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.bikes.near.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading nearby arguments")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		bikes, err := domain.GatewayListBikesNear(ctx, conf, lat, lng, radius, limit)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.bikes.near.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while fetching nearby bikes")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(bikes)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.bikes.near.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while rendering nearby bikes")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		logger.Info("nearby bikes successfully rendered")
+	}
+}
+
 // GatewayStartTrip is the handler for starting a trip.
 func GatewayStartTrip(
 	ctx context.Context,
 	conf configuration.GatewayConfiguration,
 	logger logging.Logger,
-	statter stats.Statter) func(http.ResponseWriter, *http.Request) {
+	statter stats.Statter,
+	workflows storage.WorkflowLog) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		start := time.Now()
 		defer func() {
@@ -169,25 +302,29 @@ func GatewayStartTrip(
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		defer func() {
 			_ = req.Body.Close()
 		}()
 
 		tripPayload := domain.StartTripPayload{}
 
-		err := json.NewDecoder(req.Body).Decode(&tripPayload)
+		err := validation.Decode(req, &tripPayload)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("start.trip.error", 1, 1.0)
 			}()
 
-			logger.WithError(err).Error("an error occuring while unmarshalling start payload")
+			logger.WithError(err).Error("an error occuring while reading start payload")
 			Erroring(ctx, w, err, logger)
 			return
 		}
 
-		trip, err := domain.GatewayStartTrip(ctx, conf, tripPayload.BikeID, tripPayload.Location.Lat,
-			tripPayload.Location.Lng)
+		lat, lng := tripPayload.Location.Point()
+		trip, err := domain.GatewayStartTrip(ctx, conf, workflows, logger, tripPayload.BikeID, auth.RiderFromContext(ctx),
+			lat, lng, tripPayload.RecordedAt)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("start.trip.error", 1, 1.0)
@@ -213,12 +350,14 @@ func GatewayStartTrip(
 	}
 }
 
-// GatewayEndTrip is the handler for starting a trip.
+// GatewayEndTrip is the handler for ending a trip of the rider.
 func GatewayEndTrip(
 	ctx context.Context,
 	conf configuration.GatewayConfiguration,
 	logger logging.Logger,
-	statter stats.Statter) func(http.ResponseWriter, *http.Request) {
+	statter stats.Statter,
+	workflows storage.WorkflowLog,
+	riders *domain.TripRiders) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		start := time.Now()
 		defer func() {
@@ -232,25 +371,40 @@ func GatewayEndTrip(
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		defer func() {
 			_ = req.Body.Close()
 		}()
 
 		tripPayload := domain.EndTripPayload{}
 
-		err := json.NewDecoder(req.Body).Decode(&tripPayload)
+		err := validation.Decode(req, &tripPayload)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("end.trip.error", 1, 1.0)
 			}()
 
-			logger.WithError(err).Error("an error occuring while unmarshalling end payload")
+			logger.WithError(err).Error("an error occuring while reading end payload")
 			Erroring(ctx, w, err, logger)
 			return
 		}
 
-		trip, err := domain.GatewayEndTrip(ctx, conf, tripPayload.TripID, tripPayload.Location.Lat,
-			tripPayload.Location.Lng)
+		_, err = riders.Authorize(ctx, conf, tripPayload.TripID, auth.RiderFromContext(ctx))
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("end.trip.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while authorizing rider to end trip")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		lat, lng := tripPayload.Location.Point()
+		trip, err := domain.GatewayEndTrip(ctx, conf, workflows, logger, tripPayload.TripID, lat,
+			lng, tripPayload.RecordedAt)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("end.trip.error", 1, 1.0)
@@ -276,13 +430,168 @@ func GatewayEndTrip(
 	}
 }
 
+// GatewayGetTrip returns a trip of the rider given an ID.
+func GatewayGetTrip(ctx context.Context,
+	conf configuration.GatewayConfiguration,
+	logger logging.Logger,
+	statter stats.Statter,
+	riders *domain.TripRiders) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		defer func() {
+			_ = statter.TimingDuration("gateway.trip.timing", time.Since(start), 1.0)
+			_ = statter.Inc("gateway.trip.request", 1, 1.0)
+		}()
+
+		if req == nil {
+			logger.Error("received an empty request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		tripID := mux.Vars(req)["tripID"]
+
+		v := validation.Parameters()
+		v.ID("tripID", tripID, true)
+
+		err := v.Err()
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.trip.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading trip id")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		_, err = riders.Authorize(ctx, conf, tripID, auth.RiderFromContext(ctx))
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.trip.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while authorizing rider to fetch trip")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		trip, err := domain.GatewayGetTrip(ctx, conf, tripID)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.trip.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while fetching trip from trip service")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(trip)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.trip.error", 1, 1.0)
+			}()
+
+			Erroring(ctx, w, err, logger)
+			logger.WithError(err).Error("an error occuring while rendering trip")
+			return
+		}
+
+		logger.Info("trip successfully rendered")
+	}
+}
+
+// GatewayListTrips returns a paginated list of the trips of the rider,
+// of a bike or within a time range.
+func GatewayListTrips(ctx context.Context,
+	conf configuration.GatewayConfiguration,
+	logger logging.Logger,
+	statter stats.Statter,
+) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		defer func() {
+			_ = statter.TimingDuration("gateway.list.trips.timing", time.Since(start), 1.0)
+			_ = statter.Inc("gateway.list.trips.request", 1, 1.0)
+		}()
+
+		if req == nil {
+			logger.Error("received an empty request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		bikeID, from, to, statuses, err := GetTripsArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading trip filters")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		// an empty rider would list the trips of every rider.
+		riderID := auth.RiderFromContext(ctx)
+		if riderID == "" {
+			Erroring(ctx, w, auth.ErrMissingToken, logger)
+			return
+		}
+
+		cursor, limit, err := GetPaginationArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading pagination arguments")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		trips, err := domain.GatewayListTrips(ctx, conf, riderID, bikeID,
+			from, to, statuses, cursor, limit)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while fetching list of trips")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(trips)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("gateway.list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while rendering list of trips")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		logger.Info("trip list successfully rendered")
+	}
+}
+
 // TrackTrip is the middleware for tracking a trip.
 // By tracking, we mean here, adding a location to a trip.
 func TrackTrip(ctx context.Context,
 	conf configuration.GatewayConfiguration,
 	logger logging.Logger,
 	statter stats.Statter,
-	messenger messaging.Emitter) func(http.ResponseWriter, *http.Request) {
+	messenger messaging.Emitter,
+	riders *domain.TripRiders) func(http.ResponseWriter, *http.Request) {
 
 	return func(w http.ResponseWriter, req *http.Request) {
 		start := time.Now()
@@ -297,23 +606,42 @@ func TrackTrip(ctx context.Context,
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		defer func() {
 			_ = req.Body.Close()
 		}()
 
 		hearbeat := domain.TrackTripPayload{}
 
-		err := json.NewDecoder(req.Body).Decode(&hearbeat)
+		err := validation.Decode(req, &hearbeat)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("track.trip.error", 1, 1.0)
 			}()
 
-			logger.WithError(err).Error("an error occuring while unmarshalling end payload")
+			logger.WithError(err).Error("an error occuring while reading track payload")
 			Erroring(ctx, w, err, logger)
 			return
 		}
 
+		bikeID, err := riders.Authorize(ctx, conf, hearbeat.TripID, auth.RiderFromContext(ctx))
+		if err == nil && hearbeat.BikeID != "" && hearbeat.BikeID != bikeID {
+			err = storage.ErrTripNotFound
+		}
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("track.trip.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while authorizing rider to track trip")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		hearbeat.BikeID = bikeID
+
 		err = domain.TrackTrip(ctx, messenger, hearbeat)
 		if err != nil {
 			defer func() {
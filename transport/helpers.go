@@ -3,6 +3,7 @@ package transport
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -10,23 +11,122 @@ import (
 	"github.com/gorilla/handlers"
 
 	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/domain"
+	"github.com/EarvinKayonga/rider/geo"
+)
+
+// Bounds of the nearby bikes search.
+const (
+	// DefaultRadius is the search radius in meters when none is given.
+	DefaultRadius = 500
+
+	// MaxRadius is the largest search radius in meters.
+	MaxRadius = 10000
 )
 
 // GetPaginationArguments extract limit and cursor from request.
-func GetPaginationArguments(req *http.Request) (string, int64) {
+func GetPaginationArguments(req *http.Request) (string, int64, error) {
 	if req.URL == nil {
-		return "", 20
+		return "", 20, nil
 	}
 
 	queries := req.URL.Query()
 	cursorID := queries.Get("cursor")
+	if queries.Get("limit") == "" {
+		return cursorID, 20, nil
+	}
 
 	limit, err := strconv.ParseInt(queries.Get("limit"), 10, 64)
+	if err != nil || limit < 0 {
+		return "", 0, domain.ErrInvalidQuery
+	}
+
+	return cursorID, limit, nil
+}
+
+// GetNearbyArguments extract location, radius and limit from request.
+func GetNearbyArguments(req *http.Request) (float64, float64, float64, int64, error) {
+	if req.URL == nil {
+		return 0, 0, 0, 0, domain.ErrInvalidQuery
+	}
+
+	queries := req.URL.Query()
+
+	lat, err := strconv.ParseFloat(queries.Get("lat"), 64)
+	if err != nil {
+		return 0, 0, 0, 0, domain.ErrInvalidQuery
+	}
+
+	lng, err := strconv.ParseFloat(queries.Get("lng"), 64)
 	if err != nil {
-		return cursorID, 20
+		return 0, 0, 0, 0, domain.ErrInvalidQuery
+	}
+
+	if !geo.ValidCoordinates(lat, lng) {
+		return 0, 0, 0, 0, domain.ErrInvalidQuery
+	}
+
+	radius := float64(DefaultRadius)
+	if queries.Get("radius") != "" {
+		radius, err = strconv.ParseFloat(queries.Get("radius"), 64)
+		// NaN would pass the bounds, as any comparison with it is false.
+		if err != nil || math.IsNaN(radius) || math.IsInf(radius, 0) || radius <= 0 || radius > MaxRadius {
+			return 0, 0, 0, 0, domain.ErrInvalidQuery
+		}
+	}
+
+	_, limit, err := GetPaginationArguments(req)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	if limit == 0 {
+		limit = 20
+	}
+
+	return lat, lng, radius, limit, nil
+}
+
+// GetTripsArguments extract the filters of a trip listing from request:
+// either a bike, or a time range and statuses.
+func GetTripsArguments(req *http.Request) (string, time.Time, time.Time, []int, error) {
+	from, to, statuses := time.Time{}, time.Time{}, []int{}
+	if req.URL == nil {
+		return "", from, to, statuses, nil
+	}
+
+	var err error
+	queries := req.URL.Query()
+
+	if queries.Get("from") != "" {
+		from, err = time.Parse(time.RFC3339, queries.Get("from"))
+		if err != nil {
+			return "", from, to, statuses, domain.ErrInvalidQuery
+		}
+	}
+
+	if queries.Get("to") != "" {
+		to, err = time.Parse(time.RFC3339, queries.Get("to"))
+		if err != nil {
+			return "", from, to, statuses, domain.ErrInvalidQuery
+		}
+	}
+
+	for _, value := range queries["status"] {
+		status, err := strconv.Atoi(value)
+		if err != nil {
+			return "", from, to, statuses, domain.ErrInvalidQuery
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	bikeID := queries.Get("bike_id")
+	if bikeID != "" && (!from.IsZero() || !to.IsZero() || len(statuses) > 0) {
+		return "", from, to, statuses, domain.ErrInvalidQuery
 	}
 
-	return cursorID, limit
+	return bikeID, from, to, statuses, nil
 }
 
 func health(_ context.Context, metadata Metadata) func(http.ResponseWriter, *http.Request) {
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/EarvinKayonga/rider/auth"
+	"github.com/EarvinKayonga/rider/configuration"
+	"github.com/EarvinKayonga/rider/domain"
+	"github.com/EarvinKayonga/rider/httpx"
+	"github.com/EarvinKayonga/rider/logging"
+)
+
+// Headers describing the rate limit of a client.
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+)
+
+// rateLimited rejects with 429 the requests of the clients
+// exceeding their rate on route, and tells every client
+// about its rate limit in the response headers.
+func rateLimited(limiter *httpx.RateLimiter, clients *clients,
+	logger logging.Logger, route string, handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req == nil {
+			handler(w, req)
+			return
+		}
+
+		limit := limiter.Allow(route, clients.key(req))
+		if limit.Limit > 0 {
+			w.Header().Set(RateLimitLimitHeader, strconv.Itoa(limit.Limit))
+			w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(limit.Remaining))
+		}
+
+		if limit.Allowed {
+			handler(w, req)
+			return
+		}
+
+		tooManyRequests(w, req, limit, logger)
+	}
+}
+
+// ipLimited rejects with 429 the requests of the ips exceeding their rate,
+// leaving the rate limit headers to the limit following it.
+func ipLimited(limiter *httpx.RateLimiter, clients *clients,
+	logger logging.Logger, handler http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req == nil {
+			handler(w, req)
+			return
+		}
+
+		limit := limiter.Allow("", "ip:"+clients.ip(req))
+		if limit.Allowed {
+			handler(w, req)
+			return
+		}
+
+		tooManyRequests(w, req, limit, logger)
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, req *http.Request,
+	limit httpx.RateLimit, logger logging.Logger) {
+
+	w.Header().Set("Retry-After", strconv.FormatInt(limit.RetryAfterSeconds(), 10))
+	Erroring(req.Context(), w, domain.ErrTooManyRequests, logger)
+}
+
+// clients identifies the clients of the requests as configured.
+type clients struct {
+	conf    configuration.Limiter
+	apiKeys map[string]bool
+	proxies []*net.IPNet
+}
+
+// newClients returns the clients of conf,
+// reading its api keys and trusted proxies.
+func newClients(conf configuration.Limiter) (*clients, error) {
+	e := &clients{
+		conf:    conf,
+		apiKeys: make(map[string]bool, len(conf.APIKeys)),
+	}
+
+	for _, key := range conf.APIKeys {
+		e.apiKeys[key] = true
+	}
+
+	for _, proxy := range conf.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy: %s", proxy)
+		}
+
+		e.proxies = append(e.proxies, network)
+	}
+
+	return e, nil
+}
+
+// key identifies the client of a request as configured,
+// falling back to its ip. Only the configured api keys
+// tell clients apart, others could be made up at will.
+func (e *clients) key(req *http.Request) string {
+	switch e.conf.Key {
+	case configuration.LimiterKeyRider:
+		if riderID := auth.RiderFromContext(req.Context()); riderID != "" {
+			return "rider:" + riderID
+		}
+
+	case configuration.LimiterKeyAPIKey:
+		if key := req.Header.Get(e.conf.APIKeyHeader); key != "" && e.apiKeys[key] {
+			return "key:" + key
+		}
+	}
+
+	return "ip:" + e.ip(req)
+}
+
+// ip returns the ip of the client of a request. When the proxies in front
+// are trusted, it is the right-most hop of X-Forwarded-For which is not
+// a trusted proxy, as the hops on its left are written by the client.
+func (e *clients) ip(req *http.Request) string {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+
+	if !e.conf.TrustForwardedFor || !e.trusted(peer, true) {
+		return peer
+	}
+
+	hops := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		if net.ParseIP(hop) == nil {
+			// a malformed hop was not written by a trusted proxy.
+			return peer
+		}
+
+		if !e.trusted(hop, false) {
+			return hop
+		}
+
+		peer = hop
+	}
+
+	return peer
+}
+
+// trusted tells whether ip is a trusted proxy, the peer of the gateway
+// being one when no proxy is configured.
+func (e *clients) trusted(ip string, peer bool) bool {
+	if len(e.proxies) == 0 {
+		return peer
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range e.proxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
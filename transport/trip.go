@@ -12,6 +12,7 @@ import (
 	"github.com/EarvinKayonga/rider/configuration"
 	"github.com/EarvinKayonga/rider/domain"
 	"github.com/EarvinKayonga/rider/logging"
+	"github.com/EarvinKayonga/rider/models"
 	"github.com/EarvinKayonga/rider/stats"
 )
 
@@ -31,7 +32,7 @@ func NewTripService(
 		return nil, errors.Wrap(err, "cannot register routes for Trip service")
 	}
 
-	securedRouter := secureHeaders(router)
+	securedRouter := secureHeaders(withRequestID(ctx, router))
 
 	return NewServer(ctx, conf.Server, securedRouter)
 }
@@ -45,8 +46,10 @@ func registerRoutesForTripService(
 	statter stats.Statter) error {
 
 	router.HandleFunc("/health", health(ctx, metadata)).Methods("GET")
-	router.HandleFunc("/trip/start", StartTrip(ctx, logger, statter)).Methods("POST", "PUT")
-	router.HandleFunc("/trip/end", EndTrip(ctx, logger, statter)).Methods("POST", "PUT")
+	router.HandleFunc("/trip/start", withRoute(ctx, conf.Server, "trip_start", StartTrip(ctx, logger, statter))).Methods("POST", "PUT")
+	router.HandleFunc("/trip/end", withRoute(ctx, conf.Server, "trip_end", EndTrip(ctx, logger, statter))).Methods("POST", "PUT")
+	router.HandleFunc("/trip/{tripID}", withRoute(ctx, conf.Server, "trip", GetTrip(ctx, logger, statter))).Methods("GET")
+	router.HandleFunc("/trips", withRoute(ctx, conf.Server, "trips", ListTrips(ctx, logger, statter))).Methods("GET")
 
 	return nil
 }
@@ -69,6 +72,9 @@ func StartTrip(
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		defer func() {
 			_ = req.Body.Close()
 		}()
@@ -86,8 +92,9 @@ func StartTrip(
 			return
 		}
 
-		trip, err := domain.StartTrip(ctx, tripPayload.BikeID, tripPayload.Location.Lat,
-			tripPayload.Location.Lng)
+		lat, lng := tripPayload.Location.Point()
+		trip, err := domain.StartTrip(ctx, tripPayload.BikeID, tripPayload.RiderID, lat,
+			lng, tripPayload.RecordedAt)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("start.trip.error", 1, 1.0)
@@ -131,6 +138,9 @@ func EndTrip(
 			return
 		}
 
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
 		defer func() {
 			_ = req.Body.Close()
 		}()
@@ -148,8 +158,9 @@ func EndTrip(
 			return
 		}
 
-		trip, err := domain.EndTrip(ctx, tripPayload.TripID, tripPayload.Location.Lat,
-			tripPayload.Location.Lng)
+		lat, lng := tripPayload.Location.Point()
+		trip, err := domain.EndTrip(ctx, tripPayload.TripID, lat,
+			lng, tripPayload.RecordedAt)
 		if err != nil {
 			defer func() {
 				_ = statter.Inc("end.trip.error", 1, 1.0)
@@ -174,3 +185,126 @@ func EndTrip(
 		logger.Info("trip successfully ended")
 	}
 }
+
+// GetTrip is the handler returning a trip given an ID.
+func GetTrip(
+	ctx context.Context,
+	logger logging.Logger,
+	statter stats.Statter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		defer func() {
+			_ = statter.TimingDuration("trip.timing", time.Since(start), 1.0)
+			_ = statter.Inc("trip.request", 1, 1.0)
+		}()
+
+		if req == nil {
+			logger.Error("received an empty request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		trip, err := domain.GetTrip(ctx, mux.Vars(req)["tripID"])
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("trip.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while fetching trip")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(trip)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("trip.error", 1, 1.0)
+			}()
+
+			Erroring(ctx, w, err, logger)
+			logger.WithError(err).Error("an error occuring while rendering trip")
+			return
+		}
+
+		logger.Info("trip successfully rendered")
+	}
+}
+
+// ListTrips is the handler returning a paginated list of trips,
+// of a bike or within a time range, and of a rider when rider_id is set.
+func ListTrips(
+	ctx context.Context,
+	logger logging.Logger,
+	statter stats.Statter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		defer func() {
+			_ = statter.TimingDuration("list.trips.timing", time.Since(start), 1.0)
+			_ = statter.Inc("list.trips.request", 1, 1.0)
+		}()
+
+		if req == nil {
+			logger.Error("received an empty request")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		logger := logger.WithContext(ctx)
+
+		bikeID, from, to, statuses, err := GetTripsArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading trip filters")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		var trips []models.Trip
+		cursor, limit, err := GetPaginationArguments(req)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while reading pagination arguments")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		riderID := req.URL.Query().Get("rider_id")
+		if bikeID != "" {
+			trips, err = domain.ListTripsForBike(ctx, bikeID, riderID, cursor, limit)
+		} else {
+			trips, err = domain.ListTrips(ctx, riderID, from, to, statuses, cursor, limit)
+		}
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while fetching list of trips")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(trips)
+		if err != nil {
+			defer func() {
+				_ = statter.Inc("list.trips.error", 1, 1.0)
+			}()
+
+			logger.WithError(err).Error("an error occuring while rendering list of trips")
+			Erroring(ctx, w, err, logger)
+			return
+		}
+
+		logger.Info("trip list successfully rendered")
+	}
+}
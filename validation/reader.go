@@ -0,0 +1,28 @@
+package validation
+
+import "io"
+
+// limitedReader fails with ErrBodyTooLarge once
+// more than remaining bytes are read.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrBodyTooLarge
+	}
+
+	return n, err
+}
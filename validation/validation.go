@@ -0,0 +1,134 @@
+// Package validation checks the payloads and parameters
+// received by the gateway, reporting every invalid field.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/EarvinKayonga/rider/entropy"
+	"github.com/EarvinKayonga/rider/problem"
+)
+
+// MaxBodySize bounds the size of the payloads, in bytes.
+const MaxBodySize = 64 << 10
+
+// Validation based errors.
+var (
+	ErrMalformedBody     = problem.New("malformed_body", http.StatusBadRequest, "malformed body")
+	ErrBodyTooLarge      = problem.New("body_too_large", http.StatusRequestEntityTooLarge, "body too large")
+	ErrInvalidParameters = problem.New("invalid_parameters", http.StatusBadRequest, "invalid parameters")
+	ErrInvalidFields     = problem.New("invalid_fields", http.StatusUnprocessableEntity, "invalid fields")
+
+	errTrailingData = errors.New("unexpected data after the payload")
+)
+
+// Payload is a body checking its own fields.
+type Payload interface {
+	Validate() error
+}
+
+// Decode strictly decodes the body of a request into payload,
+// rejecting unknown fields and bodies over MaxBodySize,
+// before validating it.
+func Decode(req *http.Request, payload Payload) error {
+	if req.Body == nil {
+		return ErrMalformedBody.WithDetail("empty body")
+	}
+
+	decoder := json.NewDecoder(&limitedReader{
+		reader:    req.Body,
+		remaining: MaxBodySize,
+	})
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(payload)
+	if err == nil && decoder.More() {
+		err = errTrailingData
+	}
+
+	switch {
+	case err == ErrBodyTooLarge:
+		return ErrBodyTooLarge
+	case err == io.EOF:
+		return ErrMalformedBody.WithDetail("empty body")
+	case err != nil:
+		return ErrMalformedBody.WithDetail(err.Error())
+	}
+
+	return payload.Validate()
+}
+
+// Validator collects the invalid fields of a request.
+type Validator struct {
+	invalid *problem.Error
+	fields  []problem.InvalidField
+}
+
+// Fields returns a Validator of the fields of a payload,
+// invalid ones being answered with 422.
+func Fields() *Validator {
+	return &Validator{
+		invalid: ErrInvalidFields,
+	}
+}
+
+// Parameters returns a Validator of the path and query parameters,
+// invalid ones being answered with 400.
+func Parameters() *Validator {
+	return &Validator{
+		invalid: ErrInvalidParameters,
+	}
+}
+
+// Check reports field as invalid for reason unless ok.
+func (v *Validator) Check(ok bool, field, reason string) {
+	if !ok {
+		v.fields = append(v.fields, problem.InvalidField{
+			Name:   field,
+			Reason: reason,
+		})
+	}
+}
+
+// Required checks that field is set.
+func (v *Validator) Required(field, value string) {
+	v.Check(value != "", field, "is required")
+}
+
+// ID checks that field is a ulid, when required or set.
+func (v *Validator) ID(field, value string, required bool) {
+	v.Identifier(field, value, required, entropy.IsValidID)
+}
+
+// Identifier checks that field is an id accepted by valid,
+// when required or set.
+func (v *Validator) Identifier(field, value string, required bool, valid func(string) bool) {
+	if value == "" {
+		v.Check(!required, field, "is required")
+		return
+	}
+
+	v.Check(valid(value), field, "is not a valid id")
+}
+
+// Latitude checks that field is a latitude in degrees.
+func (v *Validator) Latitude(field string, lat float64) {
+	v.Check(lat >= -90 && lat <= 90, field, "must be between -90 and 90")
+}
+
+// Longitude checks that field is a longitude in degrees.
+func (v *Validator) Longitude(field string, lng float64) {
+	v.Check(lng >= -180 && lng <= 180, field, "must be between -180 and 180")
+}
+
+// Err returns the error listing every invalid field, if any.
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+
+	return v.invalid.WithFields(v.fields)
+}